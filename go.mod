@@ -2,7 +2,4 @@ module raytracer
 
 go 1.21.0
 
-require (
-	github.com/TwFlem/pipe v0.0.0-20231001042535-36ac8cb81796
-	golang.org/x/exp v0.0.0-20231006140011-7918f672742d
-)
+require golang.org/x/exp v0.0.0-20231006140011-7918f672742d
@@ -0,0 +1,57 @@
+package internal
+
+import "math"
+
+// adaptiveMinLuminance keeps the relative error of nearly black pixels from blowing up, so a pixel that only
+// ever sees a dark background converges as soon as its first batch is in
+const adaptiveMinLuminance = 0.01
+
+// sampleStats is Welford's running mean and variance of the luminance of a pixel's samples
+type sampleStats struct {
+	n    int
+	mean float64
+	m2   float64
+}
+
+func (s *sampleStats) add(col Vec3) {
+	x := float64(luminance(col))
+	s.n++
+	delta := x - s.mean
+	s.mean += delta / float64(s.n)
+	s.m2 += delta * (x - s.mean)
+}
+
+// variance is the unbiased sample variance, 0 until there are two samples
+func (s *sampleStats) variance() float64 {
+	if s.n < 2 {
+		return 0
+	}
+	return s.m2 / float64(s.n-1)
+}
+
+// relativeError is the standard error of the mean luminance divided by the mean, the fraction the pixel is
+// likely still off by
+func (s *sampleStats) relativeError() float32 {
+	if s.n < 2 {
+		return float32(math.Inf(1))
+	}
+	stdErr := math.Sqrt(s.variance() / float64(s.n))
+	return float32(stdErr / math.Max(s.mean, adaptiveMinLuminance))
+}
+
+// heatmapStops are the colors of displayHeatmap from none to the most samples
+var heatmapStops = []Vec3{
+	NewVec3(0, 0, 0.5),
+	NewVec3(0, 0.5, 1),
+	NewVec3(0, 1, 0),
+	NewVec3(1, 1, 0),
+	NewVec3(1, 0, 0),
+}
+
+// displayHeatmap colors t from 0 to 1 from dark blue through green and yellow to red
+func displayHeatmap(t float32) Vec3 {
+	t = Clamp(0, 1, t) * float32(len(heatmapStops)-1)
+	k := min(int(t), len(heatmapStops)-2)
+	f := t - float32(k)
+	return Add(Scale(heatmapStops[k], 1-f), Scale(heatmapStops[k+1], f))
+}
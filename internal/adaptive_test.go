@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSampleStatsMatchesTwoPass(t *testing.T) {
+	randCtx := rand.New(rand.NewSource(1))
+	xs := make([]float64, 1000)
+	var stats sampleStats
+	for i := range xs {
+		x := randCtx.Float32() * 3
+		xs[i] = float64(luminance(NewVec3(x, x, x)))
+		stats.add(NewVec3(x, x, x))
+	}
+
+	mean := 0.0
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	variance := 0.0
+	for _, x := range xs {
+		variance += (x - mean) * (x - mean)
+	}
+	variance /= float64(len(xs) - 1)
+
+	if math.Abs(stats.mean-mean) > 1e-6 || math.Abs(stats.variance()-variance) > 1e-5 {
+		t.Errorf("mean %v variance %v, want %v and %v", stats.mean, stats.variance(), mean, variance)
+	}
+}
+
+// TestAdaptiveSamplingStopsConvergedPixels renders nothing but a flat background, which converges with the
+// first batch, and checks both the progress and the samples AOV count the samples that were actually taken
+func TestAdaptiveSamplingStopsConvergedPixels(t *testing.T) {
+	const width, minSamples = 8, 4
+	var last Progress
+	camera := NewCamera(1, width,
+		WithSamplesPerPixel(64),
+		WithAdaptiveSampling(minSamples, 0.05),
+		WithBackgroundColor(NewVec3(0.5, 0.7, 1)),
+		WithAOVs(AOVSamples),
+		WithWorkers(2),
+		WithTileSize(4),
+		WithProgress(func(p Progress) {
+			last = p
+		}),
+	)
+	camera.RenderFramebuffer(NewWorld())
+
+	if want := int64(width * width * minSamples); last.SamplesTraced != want {
+		t.Errorf("progress counted %d samples, want %d", last.SamplesTraced, want)
+	}
+	if got := last.SamplesPerPixel(); got != minSamples {
+		t.Errorf("progress averaged %v samples per pixel, want %d", got, minSamples)
+	}
+	if got := camera.AOV(AOVSamples).At(3, 5).X; got != minSamples {
+		t.Errorf("samples AOV = %v, want %d", got, minSamples)
+	}
+}
@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// AOV is an arbitrary output variable, an extra image rendered alongside the beauty image from what camera
+// rays hit first
+type AOV int
+
+const (
+	// AOVNormal is the world space shading normal, facing the camera
+	AOVNormal AOV = iota
+	// AOVDepth is the distance from the camera
+	AOVDepth
+	// AOVAlbedo is the color of the material before any lighting
+	AOVAlbedo
+	// AOVMaterialID numbers the materials in the order they were added to the world, 0 where nothing was hit.
+	// The camera numbers a World it renders; the IDs of a BVH are those World.NumberMaterials gave the world
+	// it was built from.
+	AOVMaterialID
+	// AOVSamples is the number of samples taken, which only varies with adaptive sampling
+	AOVSamples
+)
+
+var aovNames = []string{
+	AOVNormal:     "normal",
+	AOVDepth:      "depth",
+	AOVAlbedo:     "albedo",
+	AOVMaterialID: "id",
+	AOVSamples:    "samples",
+}
+
+func (a AOV) String() string {
+	if a < 0 || int(a) >= len(aovNames) {
+		return fmt.Sprintf("AOV(%d)", int(a))
+	}
+	return aovNames[a]
+}
+
+// ParseAOV finds the AOV with the given name, as returned by String
+func ParseAOV(name string) (AOV, error) {
+	for a, n := range aovNames {
+		if n == name {
+			return AOV(a), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown AOV %q, want one of %s", name, strings.Join(aovNames, ", "))
+}
+
+// aovPixel averages the first hits of every sample of a pixel. The material ID is taken from the first sample
+// that hits anything since IDs can not be averaged.
+type aovPixel struct {
+	normal  Vec3
+	depth   float32
+	albedo  Vec3
+	id      uint32
+	hits    int
+	samples int
+}
+
+func (p *aovPixel) add(r *Ray, hi HitInfo, ok bool) {
+	p.samples++
+	if !ok {
+		return
+	}
+
+	p.hits++
+	p.normal.Add(hi.normal)
+	p.depth += hi.t * r.dir.Len()
+	if a, ok := hi.material.(interface{ Albedo(HitInfo) Vec3 }); ok {
+		p.albedo.Add(a.Albedo(hi))
+	}
+	if p.id == 0 {
+		if m, ok := hi.material.(interface{ ID() uint32 }); ok {
+			p.id = m.ID()
+		}
+	}
+}
+
+func (p *aovPixel) value(kind AOV) Vec3 {
+	switch kind {
+	case AOVNormal:
+		if p.normal.NearZero() {
+			return NewVec3Zero()
+		}
+		return Unit(p.normal)
+	case AOVDepth:
+		if p.hits == 0 {
+			return NewVec3Zero()
+		}
+		d := p.depth / float32(p.hits)
+		return NewVec3(d, d, d)
+	case AOVAlbedo:
+		if p.samples == 0 {
+			return NewVec3Zero()
+		}
+		return Scale(p.albedo, 1/float32(p.samples))
+	case AOVMaterialID:
+		id := float32(p.id)
+		return NewVec3(id, id, id)
+	case AOVSamples:
+		n := float32(p.samples)
+		return NewVec3(n, n, n)
+	default:
+		return NewVec3Zero()
+	}
+}
+
+// aovDisplay picks how an AOV looks in 8 bit image formats. Normals are mapped from [-1, 1], depth is scaled
+// by the farthest depth in fb, material IDs get a color each, sample counts are a heatmap from blue for the
+// fewest to red for the most in fb and albedo is sRGB encoded without tone mapping.
+func aovDisplay(kind AOV, fb *Framebuffer) DisplayFunc {
+	switch kind {
+	case AOVNormal:
+		return func(n Vec3) Vec3 {
+			return Scale(Add(n, NewVec3(1, 1, 1)), 0.5)
+		}
+	case AOVDepth:
+		farthest := float32(0)
+		for _, d := range fb.pixels {
+			farthest = MaxF32(farthest, d.X)
+		}
+		if farthest <= 0 {
+			return DisplayLinear
+		}
+		return func(d Vec3) Vec3 {
+			return Scale(d, 1/farthest)
+		}
+	case AOVMaterialID:
+		return displayID
+	case AOVSamples:
+		most := float32(0)
+		for _, n := range fb.pixels {
+			most = MaxF32(most, n.X)
+		}
+		return func(n Vec3) Vec3 {
+			return displayHeatmap(n.X / MaxF32(most, 1))
+		}
+	default:
+		return DisplaySRGB
+	}
+}
+
+// displayID hashes an ID into a bright, distinct color, leaving 0 black
+func displayID(id Vec3) Vec3 {
+	if id.X <= 0 {
+		return NewVec3Zero()
+	}
+	h := uint32(id.X) * 0x9e3779b1
+	h ^= h >> 15
+	h *= 0x85ebca77
+	h ^= h >> 13
+	return NewVec3(
+		0.2+0.8*float32(h&0xff)/255,
+		0.2+0.8*float32((h>>8)&0xff)/255,
+		0.2+0.8*float32((h>>16)&0xff)/255,
+	)
+}
+
+// AOVPath is where the AOV of an image written to basePath goes, the name of the AOV inserted before the
+// extension, e.g. out/img.normal.png
+func AOVPath(basePath string, kind AOV) string {
+	ext := filepath.Ext(basePath)
+	for _, ppm := range []string{".p3.ppm", ".p6.ppm"} {
+		if strings.HasSuffix(strings.ToLower(basePath), ppm) {
+			ext = basePath[len(basePath)-len(ppm):]
+		}
+	}
+	return strings.TrimSuffix(basePath, ext) + "." + kind.String() + ext
+}
@@ -0,0 +1,118 @@
+package internal
+
+import "testing"
+
+func TestParseAOV(t *testing.T) {
+	for _, kind := range []AOV{AOVNormal, AOVDepth, AOVAlbedo, AOVMaterialID, AOVSamples} {
+		got, err := ParseAOV(kind.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != kind {
+			t.Errorf("ParseAOV(%q) = %v, want %v", kind.String(), got, kind)
+		}
+	}
+	if _, err := ParseAOV("beauty"); err == nil {
+		t.Error("ParseAOV(\"beauty\") did not fail")
+	}
+}
+
+func TestAOVPath(t *testing.T) {
+	tests := []struct {
+		base string
+		kind AOV
+		want string
+	}{
+		{"out/img.png", AOVNormal, "out/img.normal.png"},
+		{"out/img.pfm", AOVDepth, "out/img.depth.pfm"},
+		{"out/img.p3.ppm", AOVAlbedo, "out/img.albedo.p3.ppm"},
+		{"out/img.p6.ppm", AOVAlbedo, "out/img.albedo.p6.ppm"},
+		{"img", AOVMaterialID, "img.id"},
+	}
+	for _, tt := range tests {
+		if got := AOVPath(tt.base, tt.kind); got != tt.want {
+			t.Errorf("AOVPath(%q, %v) = %q, want %q", tt.base, tt.kind, got, tt.want)
+		}
+	}
+}
+
+// aovTestScene is two walls, one left of the view axis at distance 2 and one right of it at distance 3. The
+// right wall's material is created first but added last.
+func aovTestScene() (*World, *Lambertian, *Lambertian) {
+	right := NewLambertian(NewSolidColor(0.9, 0.1, 0.1))
+	left := NewLambertian(NewSolidColor(0.2, 0.4, 0.6))
+
+	world := NewWorld()
+	world.Add(NewQuad(NewVec3(-10, -10, -2), NewVec3(10, 0, 0), NewVec3(0, 20, 0), &left))
+	// Wound the other way so its normal points away from the camera
+	world.Add(NewQuad(NewVec3(0, -10, -3), NewVec3(0, 20, 0), NewVec3(10, 0, 0), &right))
+	return world, &left, &right
+}
+
+func TestAOVValues(t *testing.T) {
+	world, left, right := aovTestScene()
+	// A narrow field of view keeps every ray close to the view axis so the depth is the wall's distance
+	camera := NewCamera(2, 8,
+		WithSamplesPerPixel(4),
+		WithLookFrom(NewVec3(0, 0, 0)),
+		WithLookAt(NewVec3(0, 0, -1)),
+		WithFOVDegrees(1),
+		WithAOVs(AOVNormal, AOVDepth, AOVAlbedo, AOVMaterialID),
+		WithWorkers(1),
+	)
+	camera.RenderFramebuffer(world)
+
+	if left.ID() == 0 || right.ID() == 0 || left.ID() == right.ID() {
+		t.Fatalf("material IDs %d and %d, want two different non-zero IDs", left.ID(), right.ID())
+	}
+	if left.ID() != 1 || right.ID() != 2 {
+		t.Errorf("material IDs %d and %d, want 1 and 2 in the order they were added", left.ID(), right.ID())
+	}
+
+	tests := []struct {
+		name   string
+		i      int
+		depth  float32
+		albedo Vec3
+		id     uint32
+	}{
+		{"left", 1, 2, NewVec3(0.2, 0.4, 0.6), left.ID()},
+		{"right", 6, 3, NewVec3(0.9, 0.1, 0.1), right.ID()},
+	}
+	for _, tt := range tests {
+		if got := camera.AOV(AOVNormal).At(tt.i, 2); !approxEqualVec3(got, NewVec3(0, 0, 1), 1e-4) {
+			t.Errorf("%s wall normal = %v, want it facing the camera", tt.name, got)
+		}
+		if got := camera.AOV(AOVDepth).At(tt.i, 2).X; !approxEqual(got, tt.depth, 1e-3) {
+			t.Errorf("%s wall depth = %v, want %v", tt.name, got, tt.depth)
+		}
+		if got := camera.AOV(AOVAlbedo).At(tt.i, 2); !approxEqualVec3(got, tt.albedo, 1e-5) {
+			t.Errorf("%s wall albedo = %v, want %v", tt.name, got, tt.albedo)
+		}
+		if got := camera.AOV(AOVMaterialID).At(tt.i, 2).X; got != float32(tt.id) {
+			t.Errorf("%s wall material ID = %v, want %d", tt.name, got, tt.id)
+		}
+	}
+}
+
+func TestMaterialIDsAreStable(t *testing.T) {
+	world1, left1, right1 := aovTestScene()
+	world1.NumberMaterials()
+	world2, left2, right2 := aovTestScene()
+	world2.NumberMaterials()
+	if left1.ID() != left2.ID() || right1.ID() != right2.ID() {
+		t.Errorf("material IDs %d, %d then %d, %d, want the same IDs each time the scene is built",
+			left1.ID(), right1.ID(), left2.ID(), right2.ID())
+	}
+
+	// Numbering the outer world takes in the materials of the worlds nested in it, in its own order
+	inner, left, right := aovTestScene()
+	other := NewLambertian(NewSolidColor(1, 1, 1))
+	outer := NewWorld()
+	outer.Add(NewSphere(NewVec3(0, 0, -5), 1, &other))
+	outer.Add(inner)
+	outer.NumberMaterials()
+	if other.ID() != 1 || left.ID() != 2 || right.ID() != 3 {
+		t.Errorf("material IDs %d, %d, %d, want 1, 2, 3", other.ID(), left.ID(), right.ID())
+	}
+}
@@ -1,7 +1,7 @@
 package internal
 
 import (
-	"math/rand"
+	"math"
 
 	"golang.org/x/exp/slices"
 )
@@ -130,21 +130,35 @@ func (a Aabb) GetBounds() Aabb {
 // }
 
 type BVH struct {
-	left  Hittable
-	right Hittable
-	bBox  Aabb
+	left   Hittable
+	right  Hittable
+	bBox   Aabb
+	axis   int
+	lights *LightList
 }
 
 func NewBVHFromWorld(w *World) *BVH {
-	return NewBVH(w.hittables)
+	bvh := NewBVH(w.hittables)
+	bvh.lights = w.lights
+	return bvh
 }
 
+// NewBVH splits hittables in half along the longest side of their bounds, recursively. With nothing to hold
+// the tree is a single node that no ray hits.
 func NewBVH(hittables []Hittable) *BVH {
-	bvh := &BVH{}
+	if len(hittables) == 0 {
+		return newEmptyBVH()
+	}
 	h := make([]Hittable, len(hittables))
 	copy(h, hittables)
 
-	axis := rand.Intn(3)
+	// Splitting along the longest side of the bounds keeps the tree the same from one build to the next
+	bounds := h[0].GetBounds()
+	for _, hittable := range h[1:] {
+		bounds = NewAabbFromBoxes(bounds, hittable.GetBounds())
+	}
+	axis := bounds.LongestAxis()
+	bvh := &BVH{axis: axis}
 	var compare func(h1, h2 Hittable) int
 	switch axis {
 	case 0:
@@ -184,6 +198,16 @@ func NewBVH(hittables []Hittable) *BVH {
 	return bvh
 }
 
+// newEmptyBVH holds an empty World on both sides
+func newEmptyBVH() *BVH {
+	empty := NewWorld()
+	return &BVH{
+		left:  empty,
+		right: empty,
+		bBox:  empty.GetBounds(),
+	}
+}
+
 func HittableCompareX(h1, h2 Hittable) int {
 	diff := h2.GetBounds().x.min - h1.GetBounds().x.min
 	if diff > 0 {
@@ -251,3 +275,428 @@ func (b *BVH) Hit(r *Ray, rayT Interval) (HitInfo, bool) {
 func (b *BVH) GetBounds() Aabb {
 	return b.bBox
 }
+
+// Lights are the lights of the world the tree was built from, nil when built from a plain list
+func (b *BVH) Lights() *LightList {
+	return b.lights
+}
+
+func (a Aabb) SurfaceArea() float32 {
+	dx := a.x.max - a.x.min
+	dy := a.y.max - a.y.min
+	dz := a.z.max - a.z.min
+	return 2 * (dx*dy + dy*dz + dz*dx)
+}
+
+func (a Aabb) Centroid() Vec3 {
+	return NewVec3((a.x.min+a.x.max)/2, (a.y.min+a.y.max)/2, (a.z.min+a.z.max)/2)
+}
+
+// LongestAxis is 0, 1 or 2 for whichever of x, y and z the box is longest along
+func (a Aabb) LongestAxis() int {
+	dx := a.x.max - a.x.min
+	dy := a.y.max - a.y.min
+	dz := a.z.max - a.z.min
+	if dx >= dy && dx >= dz {
+		return 0
+	}
+	if dy >= dz {
+		return 1
+	}
+	return 2
+}
+
+func (a Aabb) axis(axis int) Interval {
+	switch axis {
+	case 0:
+		return a.x
+	case 1:
+		return a.y
+	default:
+		return a.z
+	}
+}
+
+func (v Vec3) axis(axis int) float32 {
+	switch axis {
+	case 0:
+		return v.X
+	case 1:
+		return v.Y
+	default:
+		return v.Z
+	}
+}
+
+type sahBuilder struct {
+	bins          int
+	maxLeafSize   int
+	traversalCost float32
+	intersectCost float32
+}
+
+type SAHOpt func(*sahBuilder)
+
+// WithSAHBins sets how many buckets centroids are binned into per axis when searching for a split
+func WithSAHBins(bins int) SAHOpt {
+	return func(b *sahBuilder) {
+		b.bins = bins
+	}
+}
+
+// WithSAHMaxLeafSize sets the largest number of primitives a leaf may hold
+func WithSAHMaxLeafSize(size int) SAHOpt {
+	return func(b *sahBuilder) {
+		b.maxLeafSize = size
+	}
+}
+
+// WithSAHCosts sets the relative cost of visiting a node and of intersecting a primitive
+func WithSAHCosts(traversal, intersect float32) SAHOpt {
+	return func(b *sahBuilder) {
+		b.traversalCost = traversal
+		b.intersectCost = intersect
+	}
+}
+
+func NewSAHBVHFromWorld(w *World, opts ...SAHOpt) *BVH {
+	bvh := NewSAHBVH(w.hittables, opts...)
+	bvh.lights = w.lights
+	return bvh
+}
+
+// NewSAHBVH builds a BVH using the surface area heuristic over binned primitive centroids. Leaves with more
+// than one primitive are Worlds. Like NewBVH the result only depends on the input, and it is a single node no
+// ray hits when there are no hittables.
+func NewSAHBVH(hittables []Hittable, opts ...SAHOpt) *BVH {
+	b := &sahBuilder{
+		bins:          16,
+		maxLeafSize:   4,
+		traversalCost: 1,
+		intersectCost: 1,
+	}
+	for _, fn := range opts {
+		fn(b)
+	}
+	if b.bins < 2 {
+		b.bins = 2
+	}
+	if b.maxLeafSize < 1 {
+		b.maxLeafSize = 1
+	}
+	if len(hittables) == 0 {
+		return newEmptyBVH()
+	}
+
+	h := make([]Hittable, len(hittables))
+	copy(h, hittables)
+
+	root := b.build(h)
+	if bvh, ok := root.(*BVH); ok {
+		return bvh
+	}
+	return &BVH{
+		left:  root,
+		right: root,
+		bBox:  root.GetBounds(),
+	}
+}
+
+type sahBin struct {
+	bBox  Aabb
+	count int
+}
+
+func (b *sahBuilder) build(h []Hittable) Hittable {
+	bBox := h[0].GetBounds()
+	centroids := NewAabb(bBox.Centroid(), bBox.Centroid())
+	for _, hittable := range h[1:] {
+		bounds := hittable.GetBounds()
+		bBox = NewAabbFromBoxes(bBox, bounds)
+		c := bounds.Centroid()
+		centroids = NewAabbFromBoxes(centroids, NewAabb(c, c))
+	}
+
+	leafCost := b.intersectCost * float32(len(h))
+	if len(h) == 1 {
+		return h[0]
+	}
+
+	bestAxis, bestSplit := -1, 0
+	bestCost := float32(math.Inf(1))
+	parentArea := bBox.SurfaceArea()
+	bins := make([]sahBin, b.bins)
+	rightAreas := make([]float32, b.bins)
+	rightCounts := make([]int, b.bins)
+	for axis := 0; axis < 3; axis++ {
+		extent := centroids.axis(axis)
+		if extent.max-extent.min <= 0 {
+			continue
+		}
+
+		for i := range bins {
+			bins[i] = sahBin{}
+		}
+		for _, hittable := range h {
+			bounds := hittable.GetBounds()
+			i := b.binIndex(bounds.Centroid().axis(axis), extent)
+			if bins[i].count == 0 {
+				bins[i].bBox = bounds
+			} else {
+				bins[i].bBox = NewAabbFromBoxes(bins[i].bBox, bounds)
+			}
+			bins[i].count++
+		}
+
+		// Sweep from the right so every split plane knows the area and count of everything after it
+		var right Aabb
+		count := 0
+		for i := b.bins - 1; i > 0; i-- {
+			if bins[i].count > 0 {
+				if count == 0 {
+					right = bins[i].bBox
+				} else {
+					right = NewAabbFromBoxes(right, bins[i].bBox)
+				}
+				count += bins[i].count
+			}
+			rightAreas[i] = right.SurfaceArea()
+			rightCounts[i] = count
+		}
+
+		var left Aabb
+		count = 0
+		for i := 0; i < b.bins-1; i++ {
+			if bins[i].count > 0 {
+				if count == 0 {
+					left = bins[i].bBox
+				} else {
+					left = NewAabbFromBoxes(left, bins[i].bBox)
+				}
+				count += bins[i].count
+			}
+			if count == 0 || rightCounts[i+1] == 0 {
+				continue
+			}
+
+			cost := b.traversalCost + b.intersectCost*(left.SurfaceArea()*float32(count)+rightAreas[i+1]*float32(rightCounts[i+1]))/parentArea
+			if cost < bestCost {
+				bestAxis, bestSplit, bestCost = axis, i, cost
+			}
+		}
+	}
+
+	if len(h) <= b.maxLeafSize && leafCost <= bestCost {
+		leaf := NewWorld()
+		leaf.Add(h...)
+		return leaf
+	}
+
+	axis := bestAxis
+	var leftH, rightH []Hittable
+	if bestAxis < 0 {
+		axis = 0
+		// Every centroid is in the same place so no plane separates them, split the list in half instead
+		mid := len(h) / 2
+		leftH, rightH = h[:mid], h[mid:]
+	} else {
+		extent := centroids.axis(bestAxis)
+		mid := 0
+		for i := range h {
+			if b.binIndex(h[i].GetBounds().Centroid().axis(bestAxis), extent) <= bestSplit {
+				h[i], h[mid] = h[mid], h[i]
+				mid++
+			}
+		}
+		leftH, rightH = h[:mid], h[mid:]
+	}
+
+	left := b.build(leftH)
+	right := b.build(rightH)
+	return &BVH{
+		left:  left,
+		right: right,
+		bBox:  NewAabbFromBoxes(left.GetBounds(), right.GetBounds()),
+		axis:  axis,
+	}
+}
+
+func (b *sahBuilder) binIndex(c float32, extent Interval) int {
+	i := int(float32(b.bins) * (c - extent.min) / (extent.max - extent.min))
+	if i >= b.bins {
+		i = b.bins - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
+
+// BVHStats summarises the shape of a tree and the surface area heuristic estimate of its traversal cost
+type BVHStats struct {
+	Nodes      int
+	Leaves     int
+	Primitives int
+	MaxDepth   int
+	// Cost is the expected number of node visits and primitive tests, weighted by traversalCost and
+	// intersectCost, for a random ray that hits the root bounds
+	Cost float64
+}
+
+// GetBVHStats walks a tree built by NewBVH or NewSAHBVH. Anything that is not a *BVH or a *World counts as a
+// single primitive, including meshes with their own trees.
+func GetBVHStats(root Hittable, traversalCost, intersectCost float32) BVHStats {
+	var stats BVHStats
+	stats.Cost = bvhStats(root, 1, float64(traversalCost), float64(intersectCost), &stats)
+	return stats
+}
+
+func bvhStats(h Hittable, depth int, traversalCost, intersectCost float64, stats *BVHStats) float64 {
+	stats.MaxDepth = max(stats.MaxDepth, depth)
+
+	switch node := h.(type) {
+	case *BVH:
+		stats.Nodes++
+		area := float64(node.bBox.SurfaceArea())
+		if area <= 0 {
+			area = 1
+		}
+		cost := traversalCost
+		children := []Hittable{node.left, node.right}
+		// A node holding a single hittable has it on both sides
+		if node.left == node.right {
+			children = children[:1]
+		}
+		for _, child := range children {
+			childArea := float64(child.GetBounds().SurfaceArea())
+			cost += childArea / area * bvhStats(child, depth+1, traversalCost, intersectCost, stats)
+		}
+		return cost
+	case *World:
+		stats.Leaves++
+		stats.Primitives += len(node.hittables)
+		return intersectCost * float64(len(node.hittables))
+	default:
+		stats.Leaves++
+		stats.Primitives++
+		return intersectCost
+	}
+}
+
+type linearBVHNode struct {
+	bBox Aabb
+	// offset is the index of the second child for interior nodes and of the first primitive for leaves
+	offset    int32
+	primCount int32
+	axis      int32
+}
+
+// LinearBVH is a BVH compiled into one contiguous slice of nodes in depth first order. The first child of an
+// interior node directly follows it and is always the one lower along the split axis, so traversal can visit
+// the child nearest to the ray first using only the sign of the ray direction.
+type LinearBVH struct {
+	nodes      []linearBVHNode
+	primitives []Hittable
+	lights     *LightList
+}
+
+// NewLinearBVH flattens a tree made by NewBVH or NewSAHBVH. The source tree is left untouched.
+func NewLinearBVH(root *BVH) *LinearBVH {
+	lb := &LinearBVH{lights: root.lights}
+	lb.flatten(root)
+	return lb
+}
+
+func (lb *LinearBVH) flatten(h Hittable) int32 {
+	idx := int32(len(lb.nodes))
+	lb.nodes = append(lb.nodes, linearBVHNode{bBox: h.GetBounds()})
+
+	switch node := h.(type) {
+	case *BVH:
+		if node.left == node.right {
+			lb.addLeaf(idx, node.left)
+			return idx
+		}
+
+		first, second := node.left, node.right
+		if first.GetBounds().Centroid().axis(node.axis) > second.GetBounds().Centroid().axis(node.axis) {
+			first, second = second, first
+		}
+
+		lb.flatten(first)
+		offset := lb.flatten(second)
+		lb.nodes[idx].offset = offset
+		lb.nodes[idx].axis = int32(node.axis)
+	default:
+		lb.addLeaf(idx, h)
+	}
+
+	return idx
+}
+
+func (lb *LinearBVH) addLeaf(idx int32, h Hittable) {
+	prims := []Hittable{h}
+	if w, ok := h.(*World); ok {
+		prims = w.hittables
+	}
+
+	lb.nodes[idx].offset = int32(len(lb.primitives))
+	lb.nodes[idx].primCount = int32(len(prims))
+	lb.primitives = append(lb.primitives, prims...)
+}
+
+func (lb *LinearBVH) Hit(r *Ray, rayT Interval) (HitInfo, bool) {
+	if len(lb.nodes) == 0 {
+		return HitInfo{}, false
+	}
+
+	dirNeg := [3]bool{r.dir.X < 0, r.dir.Y < 0, r.dir.Z < 0}
+	closest := rayT.max
+	closestRecord := HitInfo{}
+	hitAny := false
+
+	var buf [64]int32
+	stack := buf[:0]
+	idx := int32(0)
+	for {
+		node := &lb.nodes[idx]
+		if node.bBox.Hit(r, Interval{min: rayT.min, max: closest}) {
+			if node.primCount > 0 {
+				for i := node.offset; i < node.offset+node.primCount; i++ {
+					if hi, ok := lb.primitives[i].Hit(r, Interval{min: rayT.min, max: closest}); ok {
+						hitAny = true
+						closestRecord = hi
+						closest = hi.t
+					}
+				}
+			} else if dirNeg[node.axis] {
+				stack = append(stack, idx+1)
+				idx = node.offset
+				continue
+			} else {
+				stack = append(stack, node.offset)
+				idx++
+				continue
+			}
+		}
+
+		if len(stack) == 0 {
+			break
+		}
+		idx = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+	}
+
+	return closestRecord, hitAny
+}
+
+func (lb *LinearBVH) Lights() *LightList {
+	return lb.lights
+}
+
+func (lb *LinearBVH) GetBounds() Aabb {
+	if len(lb.nodes) == 0 {
+		return Aabb{}
+	}
+	return lb.nodes[0].bBox
+}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestAabbHit(t *testing.T) {
+	box := NewAabb(NewVec3(-1, -1, -1), NewVec3(1, 1, 1))
+
+	tests := []struct {
+		name string
+		ray  *Ray
+		rayT Interval
+		want bool
+	}{
+		{"through the middle", NewRay(NewVec3(0, 0, -5), NewVec3(0, 0, 1), 0, nil), unbounded, true},
+		{"diagonal", NewRay(NewVec3(-5, -5, -5), NewVec3(1, 1, 1), 0, nil), unbounded, true},
+		{"from inside", NewRay(NewVec3Zero(), NewVec3(0, 1, 0), 0, nil), unbounded, true},
+		{"axis parallel miss", NewRay(NewVec3(2, 0, -5), NewVec3(0, 0, 1), 0, nil), unbounded, false},
+		{"pointing away", NewRay(NewVec3(0, 0, -5), NewVec3(0, 0, -1), 0, nil), unbounded, false},
+		{"passing by", NewRay(NewVec3(-5, 3, 0), NewVec3(1, 0.1, 0), 0, nil), unbounded, false},
+		{"interval ends before the box", NewRay(NewVec3(0, 0, -5), NewVec3(0, 0, 1), 0, nil), Interval{min: 0, max: 3}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := box.Hit(tt.ray, tt.rayT); got != tt.want {
+				t.Errorf("hit = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// randomWorld scatters spheres, quads and triangles with a distinct material each, so hits can be told apart
+func randomWorld(randCtx *rand.Rand, n int) *World {
+	world := NewWorld()
+	randPoint := func() Vec3 {
+		return NewVec3RandRange32(randCtx, -10, 10)
+	}
+	for i := 0; i < n; i++ {
+		mat := NewLambertian(NewSolidColor(float32(i), 0, 0))
+		switch i % 3 {
+		case 0:
+			world.Add(NewSphere(randPoint(), RandF32N(randCtx, 0.1, 1.5), &mat))
+		case 1:
+			world.Add(NewQuad(randPoint(), NewVec3RandRange32(randCtx, -2, 2), NewVec3RandRange32(randCtx, -2, 2), &mat))
+		case 2:
+			p := randPoint()
+			world.Add(NewTriangle(p, Add(p, NewVec3RandRange32(randCtx, -2, 2)), Add(p, NewVec3RandRange32(randCtx, -2, 2)), &mat))
+		}
+	}
+	return world
+}
+
+func TestBVHMatchesWorld(t *testing.T) {
+	randCtx := rand.New(rand.NewSource(1))
+	world := randomWorld(randCtx, 300)
+
+	trees := map[string]Hittable{
+		"median":      NewBVHFromWorld(world),
+		"sah":         NewSAHBVHFromWorld(world),
+		"linear":      NewLinearBVH(NewBVHFromWorld(world)),
+		"linear sah":  NewLinearBVH(NewSAHBVHFromWorld(world)),
+		"small leafs": NewSAHBVHFromWorld(world, WithSAHMaxLeafSize(1)),
+	}
+
+	rays := make([]*Ray, 2000)
+	for i := range rays {
+		rays[i] = NewRay(NewVec3RandRange32(randCtx, -15, 15), NewVec3UnitRandOnUnitSphere32(randCtx), 0, nil)
+	}
+
+	for name, tree := range trees {
+		t.Run(name, func(t *testing.T) {
+			hits := 0
+			for _, r := range rays {
+				want, wantOK := world.Hit(r, unbounded)
+				got, gotOK := tree.Hit(r, unbounded)
+				if gotOK != wantOK {
+					t.Fatalf("ray %v %v: hit = %v, brute force hit = %v", r.origin, r.dir, gotOK, wantOK)
+				}
+				if !wantOK {
+					continue
+				}
+				hits++
+				if !approxEqual(got.t, want.t, 1e-4) || got.material != want.material {
+					t.Fatalf("ray %v %v: hit t %v of %v, brute force hit t %v of %v", r.origin, r.dir, got.t, got.material, want.t, want.material)
+				}
+			}
+			if hits == 0 {
+				t.Fatal("no ray hit anything, the test is not checking much")
+			}
+		})
+	}
+}
+
+func TestBVHOfNothing(t *testing.T) {
+	trees := map[string]*BVH{
+		"median": NewBVH(nil),
+		"sah":    NewSAHBVH(nil),
+	}
+	r := NewRay(NewVec3(0, 0, -5), NewVec3(0, 0, 1), 0, nil)
+	for name, tree := range trees {
+		if _, ok := tree.Hit(r, unbounded); ok {
+			t.Errorf("empty %s BVH was hit", name)
+		}
+		if _, ok := NewLinearBVH(tree).Hit(r, unbounded); ok {
+			t.Errorf("flattened empty %s BVH was hit", name)
+		}
+		if got := GetBVHStats(tree, 1, 1).Primitives; got != 0 {
+			t.Errorf("empty %s BVH holds %d primitives", name, got)
+		}
+	}
+}
+
+// TestMaterialIDsDoNotDependOnTheBVH numbers the materials of a world and builds both kinds of tree over it.
+// The SAH builder makes worlds of its leaves, which must leave the IDs alone.
+func TestMaterialIDsDoNotDependOnTheBVH(t *testing.T) {
+	world := randomWorld(rand.New(rand.NewSource(3)), 12)
+	// A box of its own whose sides share a material, like those of the Cornell box
+	white := NewLambertian(NewSolidColor(1, 1, 1))
+	box := NewWorld()
+	for k := 0; k < 3; k++ {
+		box.Add(NewQuad(NewVec3(float32(k), 0, 0), NewVec3(1, 0, 0), NewVec3(0, 1, 0), &white))
+	}
+	world.Add(box)
+	world.NumberMaterials()
+
+	ids := func() []uint32 {
+		var ids []uint32
+		visitMaterials(world, func(m Material) {
+			ids = append(ids, m.(interface{ ID() uint32 }).ID())
+		})
+		return ids
+	}
+	want := []uint32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 13, 13}
+	if got := ids(); !slices.Equal(got, want) {
+		t.Fatalf("material IDs %v, want %v", got, want)
+	}
+
+	NewBVHFromWorld(world)
+	if got := ids(); !slices.Equal(got, want) {
+		t.Errorf("material IDs %v after building a median BVH, want %v", got, want)
+	}
+	NewSAHBVHFromWorld(world)
+	if got := ids(); !slices.Equal(got, want) {
+		t.Errorf("material IDs %v after building a SAH BVH, want %v", got, want)
+	}
+}
+
+func TestBVHBoundsContainChildren(t *testing.T) {
+	world := randomWorld(rand.New(rand.NewSource(2)), 100)
+
+	var check func(h Hittable)
+	check = func(h Hittable) {
+		bvh, ok := h.(*BVH)
+		if !ok {
+			return
+		}
+		for _, child := range []Hittable{bvh.left, bvh.right} {
+			if merged := NewAabbFromBoxes(bvh.bBox, child.GetBounds()); merged != bvh.bBox {
+				t.Fatalf("node bounds %v do not contain child bounds %v", bvh.bBox, child.GetBounds())
+			}
+			check(child)
+		}
+	}
+	check(NewBVHFromWorld(world))
+
+	if got := GetBVHStats(NewBVHFromWorld(world), 1, 1).Primitives; got != 100 {
+		t.Errorf("median BVH holds %d primitives, want 100", got)
+	}
+	if cost := GetBVHStats(NewSAHBVHFromWorld(world), 1, 1).Cost; math.IsNaN(float64(cost)) || cost <= 0 {
+		t.Errorf("SAH cost = %v, want a positive number", cost)
+	}
+}
@@ -5,19 +5,16 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"math/rand"
 	"runtime"
-	"strconv"
-	"strings"
 	"sync"
-	"time"
-
-	"github.com/TwFlem/pipe/stage"
+	"sync/atomic"
 )
 
 // CameraWorker workers that concurrently generate colors of pixels
 type CameraWorker struct {
-	rand *rand.Rand
+	sampler Sampler
+	// samples counts every sample the worker has traced, which differs between pixels with adaptive sampling
+	samples int64
 }
 
 type Camera struct {
@@ -46,9 +43,26 @@ type Camera struct {
 	defocusDiskU        Vec3
 	defocusDiskV        Vec3
 	fovRadians          float32
-	workers             chan *CameraWorker
+	workers             []*CameraWorker
+	numWorkers          int
+	tileSize            int
+	writePartial        bool
+	progress            ProgressFunc
+	heuristic           MISHeuristic
+	shutterOpen         float32
+	shutterClose        float32
+	seed                int64
+	aovs                []AOV
+	aovBuffers          map[AOV]*Framebuffer
+	denoiser            *Denoiser
+	exposure            float32
+	toneMapper          ToneMapper
+	adaptiveMinSamples  int
+	adaptiveThreshold   float32
+	samplerKind         SamplerKind
 	once                sync.Once
-	background          Color
+	background          Environment
+	encoder             ImageEncoder
 }
 
 type CameraOpt func(*Camera)
@@ -59,6 +73,13 @@ func WithSamplesPerPixel(samples int) CameraOpt {
 	}
 }
 
+// WithImageWidth overrides the image width given to NewCamera, keeping the aspect ratio
+func WithImageWidth(width int) CameraOpt {
+	return func(c *Camera) {
+		c.imageWidth = float32(width)
+	}
+}
+
 func WithMaxRayDepth(depth int) CameraOpt {
 	return func(c *Camera) {
 		c.bounceDepth = depth
@@ -95,9 +116,124 @@ func WithFocusDist(dist float32) CameraOpt {
 	}
 }
 
+// WithBackgroundColor lights the world with the same color from every direction
 func WithBackgroundColor(color Color) CameraOpt {
 	return func(c *Camera) {
-		c.background = color
+		c.background = NewConstantEnvironment(color)
+	}
+}
+
+// WithEnvironment lights the world with env, such as an EnvironmentMap, replacing the background color
+func WithEnvironment(env Environment) CameraOpt {
+	return func(c *Camera) {
+		c.background = env
+	}
+}
+
+func WithImageEncoder(encoder ImageEncoder) CameraOpt {
+	return func(c *Camera) {
+		c.encoder = encoder
+	}
+}
+
+// WithTileSize sets the width and height in pixels of the square tiles workers render at a time
+func WithTileSize(size int) CameraOpt {
+	return func(c *Camera) {
+		c.tileSize = size
+	}
+}
+
+// WithWorkers sets how many workers render tiles concurrently
+func WithWorkers(workers int) CameraOpt {
+	return func(c *Camera) {
+		c.numWorkers = workers
+	}
+}
+
+// WithPartialOutput still writes the unfinished image when a render is cancelled or runs out of time.
+// Pixels that were never rendered are left black.
+func WithPartialOutput(enabled bool) CameraOpt {
+	return func(c *Camera) {
+		c.writePartial = enabled
+	}
+}
+
+// WithProgress reports progress to fn after every finished tile
+func WithProgress(fn ProgressFunc) CameraOpt {
+	return func(c *Camera) {
+		c.progress = fn
+	}
+}
+
+// WithMISHeuristic picks how light and material samples are weighted against each other. The default is
+// PowerHeuristic.
+func WithMISHeuristic(h MISHeuristic) CameraOpt {
+	return func(c *Camera) {
+		c.heuristic = h
+	}
+}
+
+// WithShutter keeps the shutter open from time open to close. Every ray is cast at a random time in between,
+// blurring objects that move during that interval.
+func WithShutter(open, close float32) CameraOpt {
+	return func(c *Camera) {
+		c.shutterOpen = open
+		c.shutterClose = close
+	}
+}
+
+// WithSeed sets the seed that the random numbers of every pixel sample are derived from. Renders with the same
+// scene, seed and settings are identical however many workers render them, whatever the tile size and in
+// whatever order the tiles finish.
+func WithSeed(seed int64) CameraOpt {
+	return func(c *Camera) {
+		c.seed = seed
+	}
+}
+
+// WithAOVs renders the given AOVs alongside the beauty image. Get them with AOV or WriteAOVs after rendering.
+func WithAOVs(kinds ...AOV) CameraOpt {
+	return func(c *Camera) {
+		c.aovs = kinds
+	}
+}
+
+// WithDenoiser filters the noise out of the rendered image with d. The normal, depth and albedo AOVs it is
+// guided by are rendered whether or not they were asked for WithAOVs.
+func WithDenoiser(d *Denoiser) CameraOpt {
+	return func(c *Camera) {
+		c.denoiser = d
+	}
+}
+
+// WithExposure brightens the image by 2^ev before tone mapping, so +1 doubles it and -1 halves it
+func WithExposure(ev float32) CameraOpt {
+	return func(c *Camera) {
+		c.exposure = ev
+	}
+}
+
+// WithToneMapper picks how radiance too bright for the display is compressed. The default is ToneMapLinear.
+func WithToneMapper(tm ToneMapper) CameraOpt {
+	return func(c *Camera) {
+		c.toneMapper = tm
+	}
+}
+
+// WithAdaptiveSampling stops sampling pixels once they have converged. Every pixel takes at least minSamples
+// samples, then keeps taking batches of minSamples until the standard error of its luminance falls below
+// threshold times its luminance, e.g. 0.05 for 5%, or it reaches the samples per pixel.
+func WithAdaptiveSampling(minSamples int, threshold float32) CameraOpt {
+	return func(c *Camera) {
+		c.adaptiveMinSamples = minSamples
+		c.adaptiveThreshold = threshold
+	}
+}
+
+// WithSampler picks the sampler that places the samples of every pixel. The default is SamplerIndependent.
+func WithSampler(kind SamplerKind) CameraOpt {
+	return func(c *Camera) {
+		c.samplerKind = kind
 	}
 }
 
@@ -113,7 +249,12 @@ func NewCamera(aspectRatio float32, imageWidth int, opts ...CameraOpt) *Camera {
 		lookAt:              NewVec3(0, 0, 0),
 		lookFrom:            NewVec3(0, 0, -1),
 		vup:                 NewVec3(0, 1, 0),
-		background:          NewVec3(0, 0, 0),
+		background:          NewConstantEnvironment(NewVec3(0, 0, 0)),
+		encoder:             NewP3Encoder(),
+		numWorkers:          runtime.NumCPU(),
+		tileSize:            16,
+		heuristic:           PowerHeuristic,
+		toneMapper:          ToneMapLinear,
 	}
 
 	for _, fn := range opts {
@@ -164,13 +305,16 @@ func (c *Camera) init() {
 		c.defocusDiskU = Scale(c.u, defocusRadius)
 		c.defocusDiskV = Scale(c.v, defocusRadius)
 
-		numWorkers := runtime.NumCPU()
-		c.workers = make(chan *CameraWorker, numWorkers)
-		for i := 0; i < numWorkers; i++ {
-			src := rand.NewSource(time.Now().UnixNano())
-			randCtx := rand.New(src)
-			c.workers <- &CameraWorker{
-				rand: randCtx,
+		if c.numWorkers < 1 {
+			c.numWorkers = 1
+		}
+		if c.tileSize < 1 {
+			c.tileSize = 1
+		}
+		c.workers = make([]*CameraWorker, c.numWorkers)
+		for i := range c.workers {
+			c.workers[i] = &CameraWorker{
+				sampler: newSampler(c.samplerKind, c.samplesPerPixel, c.seed),
 			}
 		}
 
@@ -178,87 +322,211 @@ func (c *Camera) init() {
 }
 
 func (c *Camera) Render(world Hittable, writer io.Writer) error {
-	w := int(c.imageWidth)
-	h := int(c.imageHeight)
-	ppm := []string{
-		"P3",
-		strconv.Itoa(w) + " " + strconv.Itoa(h),
-		"255\n",
-	}
-	_, err := io.WriteString(writer, strings.Join(ppm, "\n"))
-	if err != nil {
+	return c.RenderContext(context.Background(), world, writer)
+}
+
+// RenderContext renders the world and writes the encoded image. Workers stop as soon as ctx is done, in which
+// case ctx.Err() is returned and nothing is written unless the camera was configured WithPartialOutput.
+func (c *Camera) RenderContext(ctx context.Context, world Hittable, writer io.Writer) error {
+	fb, err := c.RenderFramebufferContext(ctx, world)
+	if err != nil && !c.writePartial {
 		return err
 	}
 
-	ctx := context.Background()
+	if encErr := c.encoder.Encode(writer, fb); encErr != nil && err == nil {
+		err = encErr
+	}
+	return err
+}
+
+// RenderFramebuffer renders the world and returns the linear, unclamped radiance of every pixel. The camera's
+// exposure and tone mapper only apply when it is converted to 8 bits.
+func (c *Camera) RenderFramebuffer(world Hittable) *Framebuffer {
+	fb, _ := c.RenderFramebufferContext(context.Background(), world)
+	return fb
+}
+
+// RenderFramebufferContext is RenderFramebuffer that stops early when ctx is done. The partially rendered
+// framebuffer is returned along with ctx.Err(), unless every tile was finished anyway.
+func (c *Camera) RenderFramebufferContext(ctx context.Context, world Hittable) (*Framebuffer, error) {
+	fb := NewFramebuffer(int(c.imageWidth), int(c.imageHeight))
+	kinds := c.aovs
+	if c.denoiser != nil {
+		kinds = append([]AOV{AOVNormal, AOVDepth, AOVAlbedo}, kinds...)
+	}
+	c.aovBuffers = make(map[AOV]*Framebuffer, len(kinds))
+	for _, kind := range kinds {
+		c.aovBuffers[kind] = NewFramebuffer(fb.Width(), fb.Height())
+	}
+	if w, ok := world.(*World); ok && c.aovBuffers[AOVMaterialID] != nil {
+		w.NumberMaterials()
+	}
+	tiles := c.Tiles()
+	tracer := NewTracer(world, c.background, c.bounceDepth, c.heuristic)
 
-	// TODO: add real error handing if a chunk write fails or any other kind of error
-	// TODO: make a png or something instead of ppm
 	// TODO: give worker contexts arenas for allocations
-	colorsOut := make(chan (<-chan string), len(c.workers))
-	go func() {
-		defer close(colorsOut)
-		var wg sync.WaitGroup
-		for j := 0; j < h; j++ {
-			fmt.Printf("coloring line %d out of %d\n", j+1, h)
-			for i := 0; i < w; i++ {
-				cw := <-c.workers
-				in := make(chan string)
-				wg.Add(1)
-				go func(innerWorld Hittable, innerIn chan string, innerCw *CameraWorker, innerI, innerJ int) {
-					defer close(innerIn)
-					col := c.GetPixelColor(innerWorld, innerCw, innerI, innerJ)
-					c.workers <- innerCw
-					colorVec := col.GetColor()
-					colorVec.ToGamma2()
-					colorVec.ToRGB()
-					innerIn <- colorVec.String()
-					wg.Done()
-				}(world, in, cw, i, j)
-				colorsOut <- in
+	queue := make(chan Tile, len(tiles))
+	for _, t := range tiles {
+		queue <- t
+	}
+	close(queue)
+
+	tracker := newProgressTracker(c.progress, len(tiles), fb.Width()*fb.Height())
+	var finished atomic.Int32
+	var wg sync.WaitGroup
+	for _, cw := range c.workers {
+		wg.Add(1)
+		go func(cw *CameraWorker) {
+			defer wg.Done()
+			for t := range queue {
+				samplesBefore := cw.samples
+				if err := c.RenderTile(ctx, tracer, cw, fb, t); err != nil {
+					return
+				}
+				pixels := (t.x1 - t.x0) * (t.y1 - t.y0)
+				tracker.tileDone(pixels, cw.samples-samplesBefore)
+				finished.Add(1)
 			}
+		}(cw)
+	}
+	wg.Wait()
+
+	if c.denoiser != nil {
+		fb = c.denoiser.Denoise(fb, c.aovBuffers[AOVNormal], c.aovBuffers[AOVDepth], c.aovBuffers[AOVAlbedo])
+	}
+	fb.SetDisplay(NewToneMapDisplay(c.exposure, c.toneMapper))
+	for kind, aovFb := range c.aovBuffers {
+		aovFb.SetDisplay(aovDisplay(kind, aovFb))
+	}
+
+	// ctx may be done by the time the last tile is, which leaves nothing unfinished
+	if int(finished.Load()) == len(tiles) {
+		return fb, nil
+	}
+	return fb, ctx.Err()
+}
+
+// AOV is the AOV framebuffer of the last render, nil if it was neither asked for WithAOVs nor needed by the
+// denoiser
+func (c *Camera) AOV(kind AOV) *Framebuffer {
+	return c.aovBuffers[kind]
+}
+
+// WriteAOVs writes every AOV of the last render next to basePath, in the format its extension picks. See
+// AOVPath for the file names.
+func (c *Camera) WriteAOVs(basePath string) error {
+	for _, kind := range c.aovs {
+		fb, ok := c.aovBuffers[kind]
+		if !ok {
+			return fmt.Errorf("AOV %s has not been rendered", kind)
 		}
-		wg.Wait()
-	}()
+		if err := writeFramebuffer(AOVPath(basePath, kind), fb); err != nil {
+			return fmt.Errorf("writing AOV %s: %w", kind, err)
+		}
+	}
+	return nil
+}
 
-	orderedPixelsOut := stage.Bridge(ctx.Done(), colorsOut)
-	chunksOut := stage.Agg(ctx.Done(), orderedPixelsOut, 5000)
-	bufChunksOut := stage.Buf(ctx.Done(), chunksOut, 2)
-	chunkResultOut := c.StartChunkRenderer(writer, bufChunksOut)
+func writeFramebuffer(fname string, fb *Framebuffer) error {
+	encoder, err := NewImageEncoderFromFile(fname)
+	if err != nil {
+		return err
+	}
+	f, err := Overwrite(fname)
+	if err != nil {
+		return err
+	}
+	if err = encoder.Encode(f, fb); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
 
-	res := <-chunkResultOut
-	return res.err
+// Tile is a rectangle of pixels from (x0, y0) inclusive to (x1, y1) exclusive
+type Tile struct {
+	x0 int
+	y0 int
+	x1 int
+	y1 int
 }
 
-type RenderChunkResult struct {
-	err error
+// Tiles splits the image into tiles of at most tileSize by tileSize pixels in scanline order
+func (c *Camera) Tiles() []Tile {
+	w := int(c.imageWidth)
+	h := int(c.imageHeight)
+	var tiles []Tile
+	for y := 0; y < h; y += c.tileSize {
+		for x := 0; x < w; x += c.tileSize {
+			tiles = append(tiles, Tile{
+				x0: x,
+				y0: y,
+				x1: min(x+c.tileSize, w),
+				y1: min(y+c.tileSize, h),
+			})
+		}
+	}
+	return tiles
 }
 
-func (c *Camera) StartChunkRenderer(writer io.Writer, chunksIn <-chan []string) <-chan RenderChunkResult {
-	out := make(chan RenderChunkResult)
-	go func() {
-		defer close(out)
-		for c := range chunksIn {
-			_, err := io.WriteString(writer, strings.Join(c, "\n")+"\n")
-			if err != nil {
-				out <- RenderChunkResult{err: err}
-				break
+// RenderTile colors every pixel of the tile, checking for cancellation between pixels
+func (c *Camera) RenderTile(ctx context.Context, tracer *Tracer, cw *CameraWorker, fb *Framebuffer, t Tile) error {
+	for j := t.y0; j < t.y1; j++ {
+		for i := t.x0; i < t.x1; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if len(c.aovBuffers) == 0 {
+				fb.Set(i, j, c.GetPixelColor(tracer, cw, i, j).GetColor())
+				continue
+			}
+			var aov aovPixel
+			fb.Set(i, j, c.samplePixel(tracer, cw, i, j, &aov))
+			for kind, aovFb := range c.aovBuffers {
+				aovFb.Set(i, j, aov.value(kind))
 			}
 		}
-		out <- RenderChunkResult{err: nil}
-	}()
-	return out
+	}
+	return nil
+}
 
+func (c *Camera) GetPixelColor(tracer *Tracer, cw *CameraWorker, i, j int) Color {
+	return c.samplePixel(tracer, cw, i, j, nil)
 }
 
-func (c *Camera) GetPixelColor(world Hittable, cw *CameraWorker, i, j int) Color {
+// samplePixel averages the samples of a pixel, collecting what they hit first into aov unless it is nil. With
+// adaptive sampling the samples are taken in batches until the pixel has converged.
+func (c *Camera) samplePixel(tracer *Tracer, cw *CameraWorker, i, j int, aov *aovPixel) Vec3 {
 	sample := NewVec3Zero()
-	for k := 0; k < c.samplesPerPixel; k++ {
-		ray := c.GetRay(cw, i, j)
-		s := ray.GetColor(world, c.background, c.bounceDepth).GetColor()
-		sample.Add(s)
+	var stats sampleStats
+	n := 0
+	for n < c.samplesPerPixel {
+		batch := c.samplesPerPixel - n
+		if c.adaptiveMinSamples > 0 {
+			batch = min(batch, c.adaptiveMinSamples)
+		}
+		for k := 0; k < batch; k++ {
+			cw.sampler.StartPixelSample(i, j, n+k)
+			ray := c.GetRay(cw, i, j)
+			var s Vec3
+			if aov == nil {
+				s = tracer.GetColor(ray).GetColor()
+			} else {
+				var hi HitInfo
+				var ok bool
+				s, hi, ok = tracer.GetColorAndHit(ray)
+				aov.add(ray, hi, ok)
+			}
+			stats.add(s)
+			sample.Add(s)
+		}
+		n += batch
+		if c.adaptiveMinSamples > 0 && stats.relativeError() < c.adaptiveThreshold {
+			break
+		}
 	}
-	sample.Scale(1.0 / float32(c.samplesPerPixel))
+	cw.samples += int64(n)
+	sample.Scale(1.0 / float32(max(n, 1)))
 	return sample
 }
 
@@ -272,9 +540,9 @@ func (c *Camera) GetRay(cw *CameraWorker, i, j int) *Ray {
 	pixelCenter := c.pixel00.Cpy()
 	pixelCenter.Add(duOffset)
 	pixelCenter.Add(dvOffset)
-	pixelCenter.Add(c.sampleUnitSquare(cw.rand))
+	pixelCenter.Add(c.sampleUnitSquare(cw.sampler.Get2D()))
 
-	discSample := NewVec3RandInUnitDisk(cw.rand)
+	discSample := sampleUnitDisk(cw.sampler.Get2D())
 	origin := c.center.Cpy()
 	if c.defocusAngleRadians > 0 {
 		origin = Add(c.center, Add(Scale(c.defocusDiskU, discSample.X), Scale(c.defocusDiskV, discSample.Y)))
@@ -283,12 +551,21 @@ func (c *Camera) GetRay(cw *CameraWorker, i, j int) *Ray {
 	rayDir := pixelCenter.Cpy()
 	rayDir.Sub(origin)
 
-	return NewRay(origin, rayDir, cw.rand)
+	return NewRay(origin, rayDir, c.sampleTime(cw.sampler.Get1D()), cw.sampler)
+}
+
+// sampleTime maps u from 0 to 1 onto the time the shutter is open
+func (c *Camera) sampleTime(u float32) float32 {
+	if c.shutterClose <= c.shutterOpen {
+		return c.shutterOpen
+	}
+	return c.shutterOpen + u*(c.shutterClose-c.shutterOpen)
 }
 
-func (c *Camera) sampleUnitSquare(randCtx *rand.Rand) Vec3 {
-	dx := -0.5 + randCtx.Float32()
-	dy := -0.5 + randCtx.Float32()
+// sampleUnitSquare is the offset from the center of a pixel to the point u, v of the pixel, from 0 to 1
+func (c *Camera) sampleUnitSquare(u, v float32) Vec3 {
+	dx := -0.5 + u
+	dy := -0.5 + v
 
 	du := c.pixelDu.Cpy()
 	du.Scale(dx)
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// determinismTestScene has something of every kind that draws random numbers: a light to sample, diffuse,
+// fuzzy metal and glass surfaces, a medium and a moving sphere
+func determinismTestScene() *World {
+	light := NewDiffuseLight(NewSolidColor(8, 8, 8))
+	white := NewLambertian(NewSolidColor(0.7, 0.7, 0.7))
+	metal := NewMetal(NewVec3(0.8, 0.6, 0.4), 0.3)
+	glass := NewDielectric(1.5)
+	smoke := NewIsotropic(NewSolidColor(0.5, 0.5, 0.5))
+
+	world := NewWorld()
+	world.Add(NewQuad(NewVec3(-1, 3, -1), NewVec3(2, 0, 0), NewVec3(0, 0, 2), &light))
+	world.Add(NewQuad(NewVec3(-5, 0, -5), NewVec3(10, 0, 0), NewVec3(0, 0, 10), &white))
+	world.Add(NewSphere(NewVec3(-1.2, 0.8, 0), 0.8, &metal))
+	world.Add(NewSphere(NewVec3(1.2, 0.8, 0), 0.8, &glass))
+	world.Add(NewConstantMedium(NewSphere(NewVec3(0, 0.5, 1.2), 0.5, &white), 2, &smoke))
+	world.Add(NewMovingSphere(NewVec3(0, 2, -1), NewVec3(0.5, 2, -1), 0, 1, 0.3, &white))
+	return world
+}
+
+// TestRenderIsIndependentOfScheduling renders the same scene with one worker and a single tile and with
+// several workers and small tiles of odd sizes. The images should be identical to the bit.
+func TestRenderIsIndependentOfScheduling(t *testing.T) {
+	const width = 24
+	world := NewBVHFromWorld(determinismTestScene())
+	render := func(kind SamplerKind, workers, tileSize int) *Framebuffer {
+		camera := NewCamera(1, width,
+			WithSamplesPerPixel(4),
+			WithMaxRayDepth(6),
+			WithLookFrom(NewVec3(0, 2, 6)),
+			WithLookAt(NewVec3(0, 1, 0)),
+			WithFOVDegrees(40),
+			WithShutter(0, 1),
+			WithSampler(kind),
+			WithSeed(3),
+			WithWorkers(workers),
+			WithTileSize(tileSize),
+		)
+		return camera.RenderFramebuffer(world)
+	}
+
+	for kind := range samplerNames {
+		want := render(SamplerKind(kind), 1, width)
+		for _, run := range []struct{ workers, tileSize int }{{4, 5}, {3, 7}} {
+			got := render(SamplerKind(kind), run.workers, run.tileSize)
+			for j := 0; j < got.Height(); j++ {
+				for i := 0; i < got.Width(); i++ {
+					if got.At(i, j) != want.At(i, j) {
+						t.Fatalf("%s with %d workers and %d pixel tiles: pixel (%d, %d) is %v, want %v",
+							SamplerKind(kind), run.workers, run.tileSize, i, j, got.At(i, j), want.At(i, j))
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestRenderContextCancel cancels a render from its progress callback, once after the first tile and once
+// after the last. Only the first leaves tiles unfinished and reports the cancellation.
+func TestRenderContextCancel(t *testing.T) {
+	world := NewBVHFromWorld(determinismTestScene())
+	render := func(cancelAt func(Progress) bool) (Progress, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var last Progress
+		camera := NewCamera(1, 32,
+			WithSamplesPerPixel(2),
+			WithMaxRayDepth(4),
+			WithLookFrom(NewVec3(0, 2, 6)),
+			WithLookAt(NewVec3(0, 1, 0)),
+			WithWorkers(1),
+			WithTileSize(8),
+			WithProgress(func(p Progress) {
+				last = p
+				if cancelAt(p) {
+					cancel()
+				}
+			}),
+		)
+		_, err := camera.RenderFramebufferContext(ctx, world)
+		return last, err
+	}
+
+	p, err := render(func(p Progress) bool { return p.TilesDone == 1 })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled after the first tile: error %v, want %v", err, context.Canceled)
+	}
+	if p.TilesDone >= p.TilesTotal {
+		t.Errorf("cancelled after the first tile: %d of %d tiles finished, want fewer", p.TilesDone, p.TilesTotal)
+	}
+
+	p, err = render(func(p Progress) bool { return p.TilesDone == p.TilesTotal })
+	if err != nil {
+		t.Errorf("cancelled after the last tile: error %v, want none as nothing was left to render", err)
+	}
+	if p.TilesDone != p.TilesTotal {
+		t.Errorf("cancelled after the last tile: %d of %d tiles finished", p.TilesDone, p.TilesTotal)
+	}
+}
@@ -0,0 +1,197 @@
+package internal
+
+import "math"
+
+// atrousKernel is the 1D B3 spline the à-trous filter spreads over ever wider gaps
+var atrousKernel = [5]float32{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+// Denoiser is an edge-avoiding à-trous wavelet filter (Dammertz et al. 2010). It blurs the noise of a render
+// with a 5x5 kernel whose taps get twice as far apart every iteration, while the first hit normal, depth and
+// albedo of every pixel keep it from blurring across edges. Lighting is filtered separately from albedo, so
+// textures stay sharp.
+type Denoiser struct {
+	iterations  int
+	colorSigma  float32
+	normalSigma float32
+	depthSigma  float32
+	albedoSigma float32
+}
+
+type DenoiseOpt func(*Denoiser)
+
+// WithDenoiseIterations sets how many times the image is filtered. The kernel covers 4*2^iterations+1
+// pixels across.
+func WithDenoiseIterations(iterations int) DenoiseOpt {
+	return func(d *Denoiser) {
+		d.iterations = iterations
+	}
+}
+
+// WithDenoiseColorSigma sets how different the lighting of two pixels can be before they stop blurring into
+// each other. Larger values remove more noise and more detail.
+func WithDenoiseColorSigma(sigma float32) DenoiseOpt {
+	return func(d *Denoiser) {
+		d.colorSigma = sigma
+	}
+}
+
+// WithDenoiseNormalSigma sets how much the normals of two pixels can differ before they stop blurring into
+// each other
+func WithDenoiseNormalSigma(sigma float32) DenoiseOpt {
+	return func(d *Denoiser) {
+		d.normalSigma = sigma
+	}
+}
+
+// WithDenoiseDepthSigma sets how much the depths of two pixels can differ, relative to the depth, before
+// they stop blurring into each other
+func WithDenoiseDepthSigma(sigma float32) DenoiseOpt {
+	return func(d *Denoiser) {
+		d.depthSigma = sigma
+	}
+}
+
+func NewDenoiser(opts ...DenoiseOpt) *Denoiser {
+	d := &Denoiser{
+		iterations:  5,
+		colorSigma:  0.6,
+		normalSigma: 0.3,
+		depthSigma:  0.05,
+		albedoSigma: 0.1,
+	}
+	for _, fn := range opts {
+		fn(d)
+	}
+	return d
+}
+
+// denoiseGuide is the first hit information of a pixel that decides which neighbours it is blurred with
+type denoiseGuide struct {
+	normal Vec3
+	depth  float32
+	albedo Vec3
+}
+
+// Denoise filters the linear radiance in color, guided by the normal, depth and albedo AOVs of the same
+// render. It returns a new framebuffer.
+func (d *Denoiser) Denoise(color, normal, depth, albedo *Framebuffer) *Framebuffer {
+	w, h := color.Width(), color.Height()
+	guides := make([]denoiseGuide, w*h)
+	// The lighting of a pixel is its color divided by its albedo. Pixels without an albedo, like the
+	// background, are filtered as they are.
+	lighting := make([]Vec3, w*h)
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			g := denoiseGuide{
+				normal: normal.At(i, j),
+				depth:  depth.At(i, j).X,
+				albedo: albedo.At(i, j),
+			}
+			guides[j*w+i] = g
+			lighting[j*w+i] = demodulate(color.At(i, j), g.albedo)
+		}
+	}
+
+	next := make([]Vec3, w*h)
+	colorSigma := d.colorSigma
+	for it := 0; it < d.iterations; it++ {
+		d.atrousPass(lighting, next, guides, w, h, 1<<it, colorSigma)
+		lighting, next = next, lighting
+		// Every pass leaves less noise behind, so later passes can tell lighting edges apart with a
+		// smaller sigma
+		colorSigma /= 2
+	}
+
+	out := NewFramebuffer(w, h)
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			out.Set(i, j, modulate(lighting[j*w+i], guides[j*w+i].albedo))
+		}
+	}
+	return out
+}
+
+// atrousPass filters src into dst with the 5x5 kernel, its taps step pixels apart
+func (d *Denoiser) atrousPass(src, dst []Vec3, guides []denoiseGuide, w, h, step int, colorSigma float32) {
+	invColor := 1 / (colorSigma * colorSigma)
+	invNormal := 1 / (d.normalSigma * d.normalSigma)
+	invDepth := 1 / (d.depthSigma * d.depthSigma)
+	invAlbedo := 1 / (d.albedoSigma * d.albedoSigma)
+
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			p := j*w + i
+			center := toneCompress(src[p])
+			g := guides[p]
+
+			sum := NewVec3Zero()
+			weightSum := float32(0)
+			for ky := -2; ky <= 2; ky++ {
+				y := j + ky*step
+				if y < 0 || y >= h {
+					continue
+				}
+				for kx := -2; kx <= 2; kx++ {
+					x := i + kx*step
+					if x < 0 || x >= w {
+						continue
+					}
+					q := y*w + x
+					gq := guides[q]
+
+					diff := Sub(toneCompress(src[q]), center)
+					normalDiff := Sub(gq.normal, g.normal)
+					albedoDiff := Sub(gq.albedo, g.albedo)
+					depthDiff := (gq.depth - g.depth) / MaxF32(g.depth, 1e-3)
+					exponent := Dot(diff, diff)*invColor +
+						Dot(normalDiff, normalDiff)*invNormal +
+						Dot(albedoDiff, albedoDiff)*invAlbedo +
+						depthDiff*depthDiff*invDepth
+
+					weight := atrousKernel[kx+2] * atrousKernel[ky+2] * float32(math.Exp(float64(-exponent)))
+					sum.Add(Scale(src[q], weight))
+					weightSum += weight
+				}
+			}
+			// The center tap always has a weight of at least atrousKernel[2]^2
+			dst[p] = Scale(sum, 1/weightSum)
+		}
+	}
+}
+
+// toneCompress maps radiance into [0, 1) so bright pixels and fireflies do not dominate color differences
+func toneCompress(col Vec3) Vec3 {
+	return NewVec3(col.X/(1+col.X), col.Y/(1+col.Y), col.Z/(1+col.Z))
+}
+
+const minDemodulateAlbedo = 0.01
+
+func demodulate(col, albedo Vec3) Vec3 {
+	return NewVec3(
+		divideAlbedo(col.X, albedo.X),
+		divideAlbedo(col.Y, albedo.Y),
+		divideAlbedo(col.Z, albedo.Z),
+	)
+}
+
+func modulate(col, albedo Vec3) Vec3 {
+	return NewVec3(
+		multiplyAlbedo(col.X, albedo.X),
+		multiplyAlbedo(col.Y, albedo.Y),
+		multiplyAlbedo(col.Z, albedo.Z),
+	)
+}
+
+func divideAlbedo(c, a float32) float32 {
+	if a < minDemodulateAlbedo {
+		return c
+	}
+	return c / a
+}
+
+func multiplyAlbedo(c, a float32) float32 {
+	if a < minDemodulateAlbedo {
+		return c
+	}
+	return c * a
+}
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestDenoiserKeepsEdges denoises a noisy image of two walls meeting in the middle. The noise should be
+// mostly gone while the two sides keep their own brightness.
+func TestDenoiserKeepsEdges(t *testing.T) {
+	const w, h = 32, 16
+	color := NewFramebuffer(w, h)
+	normal := NewFramebuffer(w, h)
+	depth := NewFramebuffer(w, h)
+	albedo := NewFramebuffer(w, h)
+
+	wantAt := func(i int) float32 {
+		if i < w/2 {
+			return 0.2
+		}
+		return 0.8
+	}
+	randCtx := rand.New(rand.NewSource(1))
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			n := NewVec3(1, 0, 0)
+			if i >= w/2 {
+				n = NewVec3(0, 0, 1)
+			}
+			noisy := wantAt(i) * (0.5 + randCtx.Float32())
+			color.Set(i, j, NewVec3(noisy, noisy, noisy))
+			normal.Set(i, j, n)
+			depth.Set(i, j, NewVec3(1, 1, 1))
+			albedo.Set(i, j, NewVec3(0.5, 0.5, 0.5))
+		}
+	}
+
+	rmse := func(fb *Framebuffer) float32 {
+		sum := float32(0)
+		for j := 0; j < h; j++ {
+			for i := 0; i < w; i++ {
+				d := fb.At(i, j).X - wantAt(i)
+				sum += d * d
+			}
+		}
+		return float32(math.Sqrt(float64(sum / (w * h))))
+	}
+
+	denoised := NewDenoiser().Denoise(color, normal, depth, albedo)
+	before, after := rmse(color), rmse(denoised)
+	if after > before/3 {
+		t.Errorf("RMSE went from %.4f to %.4f, want it cut to a third or less", before, after)
+	}
+	for j := 0; j < h; j++ {
+		left, right := denoised.At(w/2-1, j).X, denoised.At(w/2, j).X
+		if !approxEqual(left, 0.2, 0.05) || !approxEqual(right, 0.8, 0.1) {
+			t.Errorf("row %d: the edge blurred to %.3f | %.3f, want 0.2 | 0.8", j, left, right)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"math"
+	"sort"
+)
+
+// Environment is the light arriving from infinitely far away, seen by rays that miss everything
+type Environment interface {
+	// Radiance is the light arriving from direction dir, which need not be normalized
+	Radiance(dir Vec3) Vec3
+}
+
+// ConstantEnvironment is the same color in every direction
+type ConstantEnvironment struct {
+	color Color
+}
+
+func NewConstantEnvironment(color Color) ConstantEnvironment {
+	return ConstantEnvironment{
+		color: color,
+	}
+}
+
+func (e ConstantEnvironment) Radiance(dir Vec3) Vec3 {
+	return e.color.GetColor()
+}
+
+// EnvironmentMap lights the world with an equirectangular image, usually an HDR photograph. The top row of the
+// image is straight up and its center looks down -z. It is also an Emitter that samples directions in
+// proportion to the luminance of the image, so bright spots like the sun or studio softboxes are found by
+// light sampling.
+type EnvironmentMap struct {
+	image     *Framebuffer
+	intensity float32
+	toLocal   Mat4
+	toWorld   Mat4
+	// rowCDF picks a row and colCDFs a pixel within it. Both are normalized cumulative sums of luminance
+	// weighted by the solid angle of each row.
+	rowCDF  []float32
+	colCDFs [][]float32
+	// pixelPDF is the probability of every pixel, rows first
+	pixelPDF []float32
+}
+
+type EnvironmentMapOpt func(*EnvironmentMap)
+
+// WithEnvironmentRotation turns the environment around the y axis
+func WithEnvironmentRotation(degrees float32) EnvironmentMapOpt {
+	return func(e *EnvironmentMap) {
+		e.toWorld = NewMat4Rotate(NewVec3(0, 1, 0), degrees)
+		e.toLocal = NewMat4Rotate(NewVec3(0, 1, 0), -degrees)
+	}
+}
+
+// WithEnvironmentIntensity scales the radiance of the image
+func WithEnvironmentIntensity(intensity float32) EnvironmentMapOpt {
+	return func(e *EnvironmentMap) {
+		e.intensity = intensity
+	}
+}
+
+func NewEnvironmentMap(image *Framebuffer, opts ...EnvironmentMapOpt) *EnvironmentMap {
+	e := &EnvironmentMap{
+		image:     image,
+		intensity: 1,
+		toLocal:   NewMat4Identity(),
+		toWorld:   NewMat4Identity(),
+	}
+	for _, fn := range opts {
+		fn(e)
+	}
+
+	w, h := image.Width(), image.Height()
+	e.pixelPDF = make([]float32, w*h)
+	e.colCDFs = make([][]float32, h)
+	e.rowCDF = make([]float32, h)
+
+	total := float32(0)
+	for j := 0; j < h; j++ {
+		sinTheta := float32(math.Sin(math.Pi * (float64(j) + 0.5) / float64(h)))
+		cdf := make([]float32, w)
+		rowSum := float32(0)
+		for i := 0; i < w; i++ {
+			weight := luminance(image.At(i, j)) * sinTheta
+			e.pixelPDF[j*w+i] = weight
+			rowSum += weight
+			cdf[i] = rowSum
+		}
+		for i := range cdf {
+			if rowSum > 0 {
+				cdf[i] /= rowSum
+			}
+		}
+		e.colCDFs[j] = cdf
+		total += rowSum
+		e.rowCDF[j] = total
+	}
+
+	if total > 0 {
+		for j := range e.rowCDF {
+			e.rowCDF[j] /= total
+		}
+		for i := range e.pixelPDF {
+			e.pixelPDF[i] /= total
+		}
+	}
+
+	return e
+}
+
+// luminance is the Rec. 709 brightness of a linear color
+func luminance(col Vec3) float32 {
+	return MaxF32(0, 0.2126*col.X+0.7152*col.Y+0.0722*col.Z)
+}
+
+func (e *EnvironmentMap) Radiance(dir Vec3) Vec3 {
+	i, j := e.pixel(e.toLocal.MulDir(dir))
+	return Scale(e.image.At(i, j), e.intensity)
+}
+
+// pixel finds the pixel seen in a local direction
+func (e *EnvironmentMap) pixel(dir Vec3) (int, int) {
+	u, v := dirToEquirect(Unit(dir))
+	i := min(int(u*float32(e.image.Width())), e.image.Width()-1)
+	j := min(int(v*float32(e.image.Height())), e.image.Height()-1)
+	return max(i, 0), max(j, 0)
+}
+
+// dirToEquirect maps a unit direction to image coordinates in [0, 1), u across and v down
+func dirToEquirect(dir Vec3) (float32, float32) {
+	u := 0.5 + float32(math.Atan2(float64(dir.X), float64(-dir.Z)))/(2*PiF32)
+	v := float32(math.Acos(float64(Clamp(-1, 1, dir.Y)))) / PiF32
+	return u, v
+}
+
+func equirectToDir(u, v float32) Vec3 {
+	phi := float64((u - 0.5) * 2 * PiF32)
+	theta := float64(v * PiF32)
+	sinTheta := math.Sin(theta)
+	return NewVec3(float32(sinTheta*math.Sin(phi)), float32(math.Cos(theta)), float32(-sinTheta*math.Cos(phi)))
+}
+
+// PDFValue converts the density of the pixel seen along dir from image area into solid angle. The origin does
+// not matter for light that is infinitely far away.
+func (e *EnvironmentMap) PDFValue(origin, dir Vec3) float32 {
+	local := Unit(e.toLocal.MulDir(dir))
+	_, v := dirToEquirect(local)
+	sinTheta := float32(math.Sin(float64(v * PiF32)))
+	if sinTheta <= 0 {
+		return 0
+	}
+
+	i, j := e.pixel(local)
+	w, h := e.image.Width(), e.image.Height()
+	pdfImage := e.pixelPDF[j*w+i] * float32(w*h)
+	return pdfImage / (2 * PiF32 * PiF32 * sinTheta)
+}
+
+func (e *EnvironmentMap) Random(origin Vec3, s Sampler) Vec3 {
+	rowU, colU := s.Get2D()
+	j := searchCDF(e.rowCDF, rowU)
+	i := searchCDF(e.colCDFs[j], colU)
+
+	jitterU, jitterV := s.Get2D()
+	u := (float32(i) + jitterU) / float32(e.image.Width())
+	v := (float32(j) + jitterV) / float32(e.image.Height())
+	return e.toWorld.MulDir(equirectToDir(u, v))
+}
+
+// searchCDF finds the first bucket whose cumulative probability exceeds x
+func searchCDF(cdf []float32, x float32) int {
+	i := sort.Search(len(cdf), func(k int) bool {
+		return cdf[k] > x
+	})
+	return min(i, len(cdf)-1)
+}
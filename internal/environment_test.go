@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+// TestEnvironmentMapPDF integrates the density of an environment with a bright spot over the sphere, which
+// should be 1, and checks that directions drawn by Random have that density by estimating the area of the
+// sphere from them
+func TestEnvironmentMapPDF(t *testing.T) {
+	img := NewFramebuffer(16, 8)
+	for j := 0; j < img.Height(); j++ {
+		for i := 0; i < img.Width(); i++ {
+			img.Set(i, j, NewVec3(0.1, 0.2, 0.3))
+		}
+	}
+	img.Set(5, 2, NewVec3(50, 40, 30))
+
+	for _, degrees := range []float32{0, 70} {
+		env := NewEnvironmentMap(img, WithEnvironmentRotation(degrees))
+
+		// sampleUniformSphere preserves area, so a grid over the square spreads evenly over the sphere
+		const n = 512
+		integral := 0.0
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				dir := sampleUniformSphere((float32(x)+0.5)/n, (float32(y)+0.5)/n)
+				integral += float64(env.PDFValue(NewVec3Zero(), dir))
+			}
+		}
+		integral *= 4 * math.Pi / (n * n)
+		if math.Abs(integral-1) > 0.01 {
+			t.Errorf("rotated by %v degrees: density integrates to %v, want 1", degrees, integral)
+		}
+
+		const samples = 100000
+		s := newSampler(SamplerIndependent, 1, 1)
+		area := 0.0
+		for k := 0; k < samples; k++ {
+			pdf := env.PDFValue(NewVec3Zero(), env.Random(NewVec3Zero(), s))
+			if pdf <= 0 {
+				t.Fatalf("rotated by %v degrees: Random gave a direction of density %v", degrees, pdf)
+			}
+			area += 1 / float64(pdf)
+		}
+		if area /= samples; math.Abs(area-4*math.Pi) > 0.03*4*math.Pi {
+			t.Errorf("rotated by %v degrees: estimated the sphere's area as %v, want %v", degrees, area, 4*math.Pi)
+		}
+	}
+}
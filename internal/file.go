@@ -1,9 +1,16 @@
 package internal
 
 import (
+	"bufio"
+	"fmt"
 	"image"
 	"image/jpeg"
+	_ "image/png"
+	"math"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 func Overwrite(fname string) (*os.File, error) {
@@ -26,3 +33,328 @@ func LoadJPEG(fname string) (image.Image, error) {
 
 	return jpeg.Decode(f)
 }
+
+// LoadImage decodes any registered image format, currently JPEG and PNG
+func LoadImage(fname string) (image.Image, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// LoadHDRImage reads a linear floating point image, Radiance RGBE for ".hdr" and Portable Float Map for ".pfm"
+func LoadHDRImage(fname string) (*Framebuffer, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch ext := strings.ToLower(filepath.Ext(fname)); ext {
+	case ".hdr":
+		return DecodeHDR(f)
+	case ".pfm":
+		return DecodePFM(f)
+	default:
+		return nil, fmt.Errorf("no hdr image decoder for extension %q", ext)
+	}
+}
+
+// LoadOBJ reads a Wavefront OBJ file into a triangle mesh. Polygons are triangulated as fans. Materials
+// from mtllib files are mapped by LoadMTL; faces without a material are light grey Lambertian.
+func LoadOBJ(fname string) (*Mesh, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	defaultMat := NewLambertian(NewSolidColor(0.8, 0.8, 0.8))
+	var (
+		positions []Vec3
+		normals   []Vec3
+		uvs       []TexCoord
+		materials          = map[string]Material{}
+		mat       Material = &defaultMat
+		triangles []Hittable
+	)
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch fields[0] {
+		case "v":
+			v, err := parseVec3(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", fname, lineNum, err)
+			}
+			positions = append(positions, v)
+		case "vn":
+			v, err := parseVec3(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", fname, lineNum, err)
+			}
+			normals = append(normals, v)
+		case "vt":
+			uv, err := parseFloats(fields[1:], 2)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", fname, lineNum, err)
+			}
+			uvs = append(uvs, TexCoord{U: uv[0], V: uv[1]})
+		case "f":
+			faceTris, err := objFace(fields[1:], positions, normals, uvs, mat)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", fname, lineNum, err)
+			}
+			triangles = append(triangles, faceTris...)
+		case "mtllib":
+			for _, lib := range fields[1:] {
+				libMats, err := LoadMTL(filepath.Join(filepath.Dir(fname), lib))
+				if err != nil {
+					return nil, err
+				}
+				for name, m := range libMats {
+					materials[name] = m
+				}
+			}
+		case "usemtl":
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("%s:%d: usemtl without a name", fname, lineNum)
+			}
+			m, ok := materials[fields[1]]
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: unknown material %q", fname, lineNum, fields[1])
+			}
+			mat = m
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(triangles) == 0 {
+		return nil, fmt.Errorf("%s: no faces", fname)
+	}
+
+	return NewMesh(triangles), nil
+}
+
+// objFace fan triangulates one face. Vertices are v, v/vt, v//vn or v/vt/vn with 1 based or negative indices.
+func objFace(verts []string, positions, normals []Vec3, uvs []TexCoord, mat Material) ([]Hittable, error) {
+	if len(verts) < 3 {
+		return nil, fmt.Errorf("face needs at least 3 vertices, got %d", len(verts))
+	}
+
+	type vertex struct {
+		p  Vec3
+		n  *Vec3
+		uv *TexCoord
+	}
+	vs := make([]vertex, len(verts))
+	for i, vert := range verts {
+		idx := strings.Split(vert, "/")
+
+		pi, err := objIndex(idx[0], len(positions))
+		if err != nil {
+			return nil, err
+		}
+		vs[i].p = positions[pi]
+
+		if len(idx) > 1 && idx[1] != "" {
+			ti, err := objIndex(idx[1], len(uvs))
+			if err != nil {
+				return nil, err
+			}
+			vs[i].uv = &uvs[ti]
+		}
+		if len(idx) > 2 && idx[2] != "" {
+			ni, err := objIndex(idx[2], len(normals))
+			if err != nil {
+				return nil, err
+			}
+			vs[i].n = &normals[ni]
+		}
+	}
+
+	tris := make([]Hittable, 0, len(vs)-2)
+	for i := 1; i < len(vs)-1; i++ {
+		a, b, c := vs[0], vs[i], vs[i+1]
+		var opts []TriangleOpt
+		if a.n != nil && b.n != nil && c.n != nil {
+			opts = append(opts, WithVertexNormals(*a.n, *b.n, *c.n))
+		}
+		if a.uv != nil && b.uv != nil && c.uv != nil {
+			opts = append(opts, WithVertexUVs(*a.uv, *b.uv, *c.uv))
+		}
+		tris = append(tris, NewTriangle(a.p, b.p, c.p, mat, opts...))
+	}
+	return tris, nil
+}
+
+func objIndex(s string, count int) (int, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad index %q", s)
+	}
+	if i < 0 {
+		i += count
+	} else {
+		i--
+	}
+	if i < 0 || i >= count {
+		return 0, fmt.Errorf("index %s out of range", s)
+	}
+	return i, nil
+}
+
+// LoadMTL reads a Wavefront material library. Each material becomes the closest existing type:
+//   - Ke that is not black is a DiffuseLight
+//   - d below 1 or illum 4, 6 or 7 is a Dielectric with index Ni
+//   - illum 3 or 5, the reflective models, is a Metal tinted by Ks with fuzz from Ns
+//   - anything else is Lambertian with map_Kd as an image texture or Kd as a solid color. Ks is dropped: a
+//     strong highlight on plastic or paint does not make it a metal.
+func LoadMTL(fname string) (map[string]Material, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	type mtl struct {
+		kd    Vec3
+		ks    Vec3
+		ke    Vec3
+		ns    float32
+		ni    float32
+		d     float32
+		illum int
+		mapKd string
+	}
+
+	var names []string
+	descs := map[string]*mtl{}
+	var cur *mtl
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if fields[0] == "newmtl" {
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("%s:%d: newmtl without a name", fname, lineNum)
+			}
+			cur = &mtl{kd: NewVec3(0.8, 0.8, 0.8), ni: 1.5, d: 1}
+			names = append(names, fields[1])
+			descs[fields[1]] = cur
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "Kd":
+			cur.kd, err = parseVec3(fields[1:])
+		case "Ks":
+			cur.ks, err = parseVec3(fields[1:])
+		case "Ke":
+			cur.ke, err = parseVec3(fields[1:])
+		case "Ns", "Ni", "d", "Tr":
+			var v []float32
+			v, err = parseFloats(fields[1:], 1)
+			if err == nil {
+				switch fields[0] {
+				case "Ns":
+					cur.ns = v[0]
+				case "Ni":
+					cur.ni = v[0]
+				case "d":
+					cur.d = v[0]
+				case "Tr":
+					cur.d = 1 - v[0]
+				}
+			}
+		case "illum":
+			cur.illum, err = strconv.Atoi(fields[len(fields)-1])
+		case "map_Kd":
+			// Texture options come before the file name, which is always last
+			cur.mapKd = filepath.Join(filepath.Dir(fname), fields[len(fields)-1])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", fname, lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	materials := make(map[string]Material, len(names))
+	for _, name := range names {
+		m := descs[name]
+		switch {
+		case !m.ke.NearZero():
+			mat := NewDiffuseLight(NewSolidColor(m.ke.X, m.ke.Y, m.ke.Z))
+			materials[name] = &mat
+		case m.d < 1 || m.illum == 4 || m.illum == 6 || m.illum == 7:
+			mat := NewDielectric(m.ni)
+			materials[name] = &mat
+		case m.illum == 3 || m.illum == 5:
+			// Rough conversion from a Phong exponent to a perceived roughness
+			fuzz := Clamp(0, 1, float32(math.Sqrt(2/(float64(m.ns)+2))))
+			mat := NewMetal(m.ks, fuzz)
+			materials[name] = &mat
+		case m.mapKd != "":
+			img, err := LoadImage(m.mapKd)
+			if err != nil {
+				return nil, fmt.Errorf("%s: material %q: %w", fname, name, err)
+			}
+			tex := NewImageTexture(img)
+			mat := NewLambertian(&tex)
+			materials[name] = &mat
+		default:
+			mat := NewLambertian(NewSolidColor(m.kd.X, m.kd.Y, m.kd.Z))
+			materials[name] = &mat
+		}
+	}
+
+	return materials, nil
+}
+
+func parseFloats(fields []string, n int) ([]float32, error) {
+	if len(fields) < n {
+		return nil, fmt.Errorf("expected %d numbers, got %d", n, len(fields))
+	}
+	out := make([]float32, n)
+	for i := 0; i < n; i++ {
+		v, err := strconv.ParseFloat(fields[i], 32)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = float32(v)
+	}
+	return out, nil
+}
+
+func parseVec3(fields []string) (Vec3, error) {
+	v, err := parseFloats(fields, 3)
+	if err != nil {
+		return Vec3{}, err
+	}
+	return NewVec3(v[0], v[1], v[2]), nil
+}
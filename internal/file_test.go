@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"errors"
+	"io/fs"
+	"math"
+	"testing"
+)
+
+func loadTestOBJ(t *testing.T, name string) []*Triangle {
+	t.Helper()
+	mesh, err := LoadOBJ("testdata/obj/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tris := make([]*Triangle, len(mesh.Triangles()))
+	for i, h := range mesh.Triangles() {
+		tris[i] = h.(*Triangle)
+	}
+	return tris
+}
+
+func TestLoadOBJFanTriangulates(t *testing.T) {
+	tris := loadTestOBJ(t, "fan.obj")
+	if len(tris) != 3 {
+		t.Fatalf("pentagon became %d triangles, want 3", len(tris))
+	}
+	area := float32(0)
+	for k, tri := range tris {
+		if tri.p0 != NewVec3(1, 0, 0) {
+			t.Errorf("triangle %d starts at %v, want every triangle to share the first vertex", k, tri.p0)
+		}
+		area += tri.area
+	}
+	if want := float32(2.5 * math.Sin(2*math.Pi/5)); !approxEqual(area, want, 1e-3) {
+		t.Errorf("triangles cover %v, want the pentagon's area %v", area, want)
+	}
+}
+
+func TestLoadOBJNegativeIndices(t *testing.T) {
+	tris := loadTestOBJ(t, "negative.obj")
+	if len(tris) != 2 {
+		t.Fatalf("square became %d triangles, want 2", len(tris))
+	}
+	if tris[0].p0 != NewVec3(0, 0, 0) || tris[0].area+tris[1].area != 1 {
+		t.Errorf("triangles start at %v and cover %v, want the unit square from the origin",
+			tris[0].p0, tris[0].area+tris[1].area)
+	}
+}
+
+func TestLoadOBJVertexAttributes(t *testing.T) {
+	tris := loadTestOBJ(t, "attributes.obj")
+	if len(tris) != 2 {
+		t.Fatalf("got %d triangles, want 2", len(tris))
+	}
+
+	// Straight down onto barycentrics (0.5, 0.25, 0.25)
+	r := NewRay(NewVec3(0.25, 0.25, 1), NewVec3(0, 0, -1), 0, nil)
+	wantNormal := Unit(Add(Add(Scale(NewVec3(0, 0, 1), 0.5), Scale(Unit(NewVec3(1, 0, 1)), 0.25)),
+		Scale(Unit(NewVec3(0, 1, 1)), 0.25)))
+	tests := []struct {
+		name   string
+		tri    *Triangle
+		wantUV TexCoord
+	}{
+		// 0.5*0.25 + 0.25*0.75 + 0.25*0.25 in both directions
+		{"v/vt/vn", tris[0], TexCoord{U: 0.375, V: 0.375}},
+		// Without vt the barycentrics are the texture coordinates
+		{"v//vn", tris[1], TexCoord{U: 0.25, V: 0.25}},
+	}
+	for _, tt := range tests {
+		hi, ok := tt.tri.Hit(r, Interval{min: 0.001, max: float32(math.Inf(1))})
+		if !ok {
+			t.Fatalf("%s: missed", tt.name)
+		}
+		if !approxEqual(hi.u, tt.wantUV.U, 1e-5) || !approxEqual(hi.v, tt.wantUV.V, 1e-5) {
+			t.Errorf("%s: uv (%v, %v), want (%v, %v)", tt.name, hi.u, hi.v, tt.wantUV.U, tt.wantUV.V)
+		}
+		if !approxEqualVec3(hi.normal, wantNormal, 1e-5) {
+			t.Errorf("%s: normal %v, want the interpolated vertex normal %v", tt.name, hi.normal, wantNormal)
+		}
+	}
+}
+
+func TestLoadOBJMissingMTL(t *testing.T) {
+	_, err := LoadOBJ("testdata/obj/missing_mtl.obj")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want one for the missing material library", err)
+	}
+}
+
+func TestLoadMTL(t *testing.T) {
+	mats, err := LoadMTL("testdata/obj/materials.mtl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mats) != 7 {
+		t.Errorf("got %d materials, want 7", len(mats))
+	}
+
+	if m, ok := mats["light"].(*DiffuseLight); !ok {
+		t.Errorf("Ke gave a %T, want a DiffuseLight", mats["light"])
+	} else if got := m.Emit(0, 0, NewVec3Zero()).GetColor(); got != NewVec3(4, 3, 2) {
+		t.Errorf("light emits %v, want Ke", got)
+	}
+
+	for name, ni := range map[string]float32{"glass": 1.33, "crystal": 2.4} {
+		if m, ok := mats[name].(*Dielectric); !ok {
+			t.Errorf("%s is a %T, want a Dielectric", name, mats[name])
+		} else if m.refractiveIndex != ni {
+			t.Errorf("%s has a refractive index of %v, want Ni %v", name, m.refractiveIndex, ni)
+		}
+	}
+
+	if m, ok := mats["mirror"].(*Metal); !ok {
+		t.Errorf("illum 3 gave a %T, want a Metal", mats["mirror"])
+	} else {
+		if m.albedo != NewVec3(0.9, 0.8, 0.7) {
+			t.Errorf("mirror albedo %v, want Ks", m.albedo)
+		}
+		if want := float32(math.Sqrt(2.0 / 100)); !approxEqual(m.fuzz, want, 1e-6) {
+			t.Errorf("mirror fuzz %v, want %v from Ns", m.fuzz, want)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		albedo Vec3
+	}{
+		{"painted", NewVec3(1, 0, 0)},
+		{"matte", NewVec3(0.2, 0.4, 0.6)},
+		// Ks brighter than Kd without illum 3 or 5 is only a highlight
+		{"glossy", NewVec3(0.3, 0.2, 0.1)},
+	}
+	for _, tt := range tests {
+		m, ok := mats[tt.name].(*Lambertian)
+		if !ok {
+			t.Errorf("%s is a %T, want a Lambertian", tt.name, mats[tt.name])
+			continue
+		}
+		if got := m.Albedo(HitInfo{u: 0.5, v: 0.5}); !approxEqualVec3(got, tt.albedo, 1e-3) {
+			t.Errorf("%s albedo %v, want %v", tt.name, got, tt.albedo)
+		}
+	}
+	if _, ok := mats["painted"].(*Lambertian).albedo.(*ImageTexture); !ok {
+		t.Errorf("map_Kd gave a %T texture, want an ImageTexture", mats["painted"].(*Lambertian).albedo)
+	}
+}
+
+func TestLoadOBJUsesMaterials(t *testing.T) {
+	tris := loadTestOBJ(t, "materials.obj")
+	if len(tris) != 3 {
+		t.Fatalf("got %d triangles, want 3", len(tris))
+	}
+	if _, ok := tris[0].material.(*Lambertian); !ok {
+		t.Errorf("face before usemtl has a %T, want the default Lambertian", tris[0].material)
+	}
+	if !isEmissive(tris[1].material) {
+		t.Errorf("face after usemtl light has a %T, want the light", tris[1].material)
+	}
+	if got := tris[2].material.(*Lambertian).Albedo(HitInfo{}); got != NewVec3(0.2, 0.4, 0.6) {
+		t.Errorf("face after usemtl matte has albedo %v, want Kd", got)
+	}
+
+	mesh, _ := LoadOBJ("testdata/obj/materials.obj")
+	if got := len(emittersOf(mesh)); got != 1 {
+		t.Errorf("mesh has %d lights, want the one face with Ke", got)
+	}
+}
@@ -5,6 +5,9 @@ import (
 )
 
 type Hittable interface {
+	// Hit finds the closest hit along r within rayT. It may be called any number of times per sample as the
+	// BVH is traversed, so it must not take numbers from the dimensions of r's sampler, only from
+	// Sampler.Independent1D.
 	Hit(r *Ray, rayT Interval) (HitInfo, bool)
 	GetBounds() Aabb
 }
@@ -39,19 +42,93 @@ func NewHitInfo(t, u, v float32, intersectingRayDirection, point, unitOutwardNor
 type World struct {
 	hittables []Hittable
 	bBox      Aabb
+	lights    *LightList
 }
 
 func NewWorld() *World {
-	return &World{}
+	return &World{
+		lights: NewLightList(),
+	}
 }
 
 func (w *World) Add(hittables ...Hittable) {
 	for i := range hittables {
+		if len(w.hittables) == 0 {
+			w.bBox = hittables[i].GetBounds()
+		} else {
+			w.bBox = NewAabbFromBoxes(w.bBox, hittables[i].GetBounds())
+		}
 		w.hittables = append(w.hittables, hittables[i])
-		w.bBox = NewAabbFromBoxes(w.bBox, hittables[i].GetBounds())
+
+		for _, e := range emittersOf(hittables[i]) {
+			w.lights.Add(e)
+		}
+	}
+}
+
+// NumberMaterials gives the materials of the world the IDs of the material ID pass, numbered from 1 in the
+// order they are stored, nested worlds included. A material used several times keeps the ID of its first use.
+// Call it on the scene's top-level world once it is complete; worlds built inside it, such as the leaves of a
+// BVH, must not be numbered on their own as that would renumber the materials they share.
+func (w *World) NumberMaterials() {
+	ids := make(map[Material]uint32)
+	visitMaterials(w, func(mat Material) {
+		if _, ok := ids[mat]; ok {
+			return
+		}
+		ids[mat] = uint32(len(ids) + 1)
+		if m, ok := mat.(interface{ setID(uint32) }); ok {
+			m.setID(ids[mat])
+		}
+	})
+}
+
+// visitMaterials calls fn with the materials of h and everything it is made of, in the order they are stored
+func visitMaterials(h Hittable, fn func(Material)) {
+	switch h := h.(type) {
+	case *World:
+		for _, c := range h.hittables {
+			visitMaterials(c, fn)
+		}
+	case *BVH:
+		visitMaterials(h.left, fn)
+		if h.right != h.left {
+			visitMaterials(h.right, fn)
+		}
+	case *LinearBVH:
+		for _, c := range h.primitives {
+			visitMaterials(c, fn)
+		}
+	case *Mesh:
+		for _, c := range h.triangles {
+			visitMaterials(c, fn)
+		}
+	case *Transform:
+		visitMaterials(h.object, fn)
+	case *MovingTransform:
+		visitMaterials(h.object, fn)
+	case *ConstantMedium:
+		// Rays never stop on the boundary, only the phase material is ever seen
+		fn(h.phase)
+	case *Sphere:
+		fn(h.Material)
+	case *MovingSphere:
+		fn(h.material)
+	case Quad:
+		fn(h.material)
+	case *Quad:
+		fn(h.material)
+	case *Triangle:
+		fn(h.material)
 	}
 }
 
+// Lights are the emissive spheres, quads and triangles added to the world, directly or inside meshes, transforms
+// and nested worlds. Moving lights are left out, see emittersOf.
+func (w *World) Lights() *LightList {
+	return w.lights
+}
+
 func (w *World) Hit(r *Ray, rayT Interval) (HitInfo, bool) {
 	hitAny := false
 	closest := rayT.max
@@ -94,10 +171,15 @@ func NewSphere(center Vec3, radius float32, mat Material) *Sphere {
 }
 
 func (s *Sphere) Hit(r *Ray, rayT Interval) (HitInfo, bool) {
-	ASubC := Sub(r.origin, s.Center)
+	return hitSphere(r, rayT, s.Center, s.Radius, s.Material)
+}
+
+// hitSphere intersects r with the sphere around center, shared by Sphere and MovingSphere
+func hitSphere(r *Ray, rayT Interval, center Vec3, radius float32, mat Material) (HitInfo, bool) {
+	ASubC := Sub(r.origin, center)
 	a := r.dir.LenSq()
 	halfB := Dot(r.dir, ASubC)
-	c := ASubC.LenSq() - s.Radius*s.Radius
+	c := ASubC.LenSq() - radius*radius
 
 	discriminate := (halfB*halfB - a*c)
 
@@ -116,7 +198,7 @@ func (s *Sphere) Hit(r *Ray, rayT Interval) (HitInfo, bool) {
 	}
 
 	point := r.At(t)
-	norm := Scale(Sub(point, s.Center), s.Radius)
+	norm := Scale(Sub(point, center), radius)
 	norm.Unit()
 
 	theta := float32(math.Acos(-float64(norm.Y)))
@@ -125,7 +207,7 @@ func (s *Sphere) Hit(r *Ray, rayT Interval) (HitInfo, bool) {
 	u := (phi + 5*PiF32/12) / (2 * PiF32)
 	v := theta / (PiF32)
 
-	hi := NewHitInfo(t, u, v, r.dir, point, norm, s.Material)
+	hi := NewHitInfo(t, u, v, r.dir, point, norm, mat)
 
 	return hi, true
 
@@ -135,6 +217,50 @@ func (s *Sphere) GetBounds() Aabb {
 	return s.bBox
 }
 
+// MovingSphere moves in a straight line from center0 at time0 to center1 at time1. It rests at either end
+// outside that interval so its bounds always cover it.
+type MovingSphere struct {
+	center0  Vec3
+	center1  Vec3
+	time0    float32
+	time1    float32
+	radius   float32
+	material Material
+	bBox     Aabb
+}
+
+func NewMovingSphere(center0, center1 Vec3, time0, time1, radius float32, mat Material) *MovingSphere {
+	rvec := NewVec3(radius, radius, radius)
+	box0 := NewAabb(Sub(center0, rvec), Add(center0, rvec))
+	box1 := NewAabb(Sub(center1, rvec), Add(center1, rvec))
+	return &MovingSphere{
+		center0:  center0,
+		center1:  center1,
+		time0:    time0,
+		time1:    time1,
+		radius:   radius,
+		material: mat,
+		bBox:     NewAabbFromBoxes(box0, box1),
+	}
+}
+
+// Center is where the sphere is at time t
+func (s *MovingSphere) Center(t float32) Vec3 {
+	if s.time1 == s.time0 {
+		return s.center0
+	}
+	f := Clamp(0, 1, (t-s.time0)/(s.time1-s.time0))
+	return Add(s.center0, Scale(Sub(s.center1, s.center0), f))
+}
+
+func (s *MovingSphere) Hit(r *Ray, rayT Interval) (HitInfo, bool) {
+	return hitSphere(r, rayT, s.Center(r.time), s.radius, s.material)
+}
+
+func (s *MovingSphere) GetBounds() Aabb {
+	return s.bBox
+}
+
 type Quad struct {
 	Q        Vec3
 	u        Vec3
@@ -142,6 +268,7 @@ type Quad struct {
 	w        Vec3
 	normal   Vec3
 	D        float32
+	area     float32
 	material Material
 	bBox     Aabb
 }
@@ -151,6 +278,8 @@ func NewQuad(Q, u, v Vec3, material Material) Quad {
 	norm := Unit(n)
 	D := Dot(norm, Q)
 	w := Scale(n, 1/Dot(n, n))
+	// Both diagonals are needed to bound a quad whose sides are not axis aligned
+	bBox := NewAabbFromBoxes(NewAabb(Q, Add(Add(Q, u), v)), NewAabb(Add(Q, u), Add(Q, v))).GetPaddedAabb()
 
 	return Quad{
 		Q:        Q,
@@ -158,8 +287,9 @@ func NewQuad(Q, u, v Vec3, material Material) Quad {
 		v:        v,
 		w:        w,
 		material: material,
-		bBox:     NewAabb(Q, Add(Add(Q, u), v)).GetPaddedAabb(),
+		bBox:     bBox,
 		D:        D,
+		area:     n.Len(),
 		normal:   norm,
 	}
 }
@@ -214,3 +344,154 @@ func Box(a, b Vec3, mat Material) []Hittable {
 		NewQuad(NewVec3(min.X, min.Y, min.Z), dx, dz, mat),
 	}
 }
+
+// TexCoord is a texture coordinate on a surface
+type TexCoord struct {
+	U float32
+	V float32
+}
+
+type Triangle struct {
+	p0       Vec3
+	e1       Vec3
+	e2       Vec3
+	normal   Vec3
+	normals  *[3]Vec3
+	uvs      *[3]TexCoord
+	area     float32
+	material Material
+	bBox     Aabb
+}
+
+type TriangleOpt func(*Triangle)
+
+// WithVertexNormals interpolates the given per vertex normals across the face for smooth shading
+func WithVertexNormals(n0, n1, n2 Vec3) TriangleOpt {
+	return func(t *Triangle) {
+		t.normals = &[3]Vec3{Unit(n0), Unit(n1), Unit(n2)}
+	}
+}
+
+// WithVertexUVs interpolates the given per vertex texture coordinates instead of reporting barycentrics
+func WithVertexUVs(uv0, uv1, uv2 TexCoord) TriangleOpt {
+	return func(t *Triangle) {
+		t.uvs = &[3]TexCoord{uv0, uv1, uv2}
+	}
+}
+
+func NewTriangle(p0, p1, p2 Vec3, mat Material, opts ...TriangleOpt) *Triangle {
+	e1 := Sub(p1, p0)
+	e2 := Sub(p2, p0)
+	min := NewVec3(MinF32(p0.X, MinF32(p1.X, p2.X)), MinF32(p0.Y, MinF32(p1.Y, p2.Y)), MinF32(p0.Z, MinF32(p1.Z, p2.Z)))
+	max := NewVec3(MaxF32(p0.X, MaxF32(p1.X, p2.X)), MaxF32(p0.Y, MaxF32(p1.Y, p2.Y)), MaxF32(p0.Z, MaxF32(p1.Z, p2.Z)))
+
+	n := Cross(e1, e2)
+	t := &Triangle{
+		p0:       p0,
+		e1:       e1,
+		e2:       e2,
+		normal:   Unit(n),
+		area:     n.Len() / 2,
+		material: mat,
+		bBox:     NewAabb(min, max).GetPaddedAabb(),
+	}
+
+	for _, fn := range opts {
+		fn(t)
+	}
+
+	return t
+}
+
+// Hit uses the Möller-Trumbore test. The determinant is compared against a tolerance relative to the
+// triangle's size so that very small and very large meshes are treated alike.
+func (t *Triangle) Hit(r *Ray, rayT Interval) (HitInfo, bool) {
+	pvec := Cross(r.dir, t.e2)
+	det := Dot(t.e1, pvec)
+
+	eps := 1e-7 * t.e1.Len() * t.e2.Len() * r.dir.Len()
+	if AbsF32(det) <= eps {
+		return HitInfo{}, false
+	}
+	invDet := 1 / det
+
+	tvec := Sub(r.origin, t.p0)
+	b1 := Dot(tvec, pvec) * invDet
+	if b1 < 0 || b1 > 1 {
+		return HitInfo{}, false
+	}
+
+	qvec := Cross(tvec, t.e1)
+	b2 := Dot(r.dir, qvec) * invDet
+	if b2 < 0 || b1+b2 > 1 {
+		return HitInfo{}, false
+	}
+
+	dist := Dot(t.e2, qvec) * invDet
+	if !rayT.In(dist, 0) {
+		return HitInfo{}, false
+	}
+
+	b0 := 1 - b1 - b2
+	u, v := b1, b2
+	if t.uvs != nil {
+		u = b0*t.uvs[0].U + b1*t.uvs[1].U + b2*t.uvs[2].U
+		v = b0*t.uvs[0].V + b1*t.uvs[1].V + b2*t.uvs[2].V
+	}
+
+	frontFace := Dot(r.dir, t.normal) < 0
+	faceNormal := t.normal
+	if !frontFace {
+		faceNormal.Scale(-1)
+	}
+
+	// The shading normal is kept on the side of the face the ray arrived from, whatever the mesh winding
+	shadingNormal := faceNormal
+	if t.normals != nil {
+		shadingNormal = Add(Add(Scale(t.normals[0], b0), Scale(t.normals[1], b1)), Scale(t.normals[2], b2))
+		shadingNormal.Unit()
+		if Dot(shadingNormal, faceNormal) < 0 {
+			shadingNormal.Scale(-1)
+		}
+	}
+
+	return HitInfo{
+		point:     r.At(dist),
+		normal:    shadingNormal,
+		t:         dist,
+		u:         u,
+		v:         v,
+		material:  t.material,
+		frontFace: frontFace,
+	}, true
+}
+
+func (t *Triangle) GetBounds() Aabb {
+	return t.bBox
+}
+
+// Mesh is a group of triangles with a BVH of its own so it can be added to a world as a single Hittable
+type Mesh struct {
+	triangles []Hittable
+	bvh       *BVH
+}
+
+func NewMesh(triangles []Hittable) *Mesh {
+	return &Mesh{
+		triangles: triangles,
+		bvh:       NewBVH(triangles),
+	}
+}
+
+// Triangles gives the individual triangles, for building a single BVH over several meshes
+func (m *Mesh) Triangles() []Hittable {
+	return m.triangles
+}
+
+func (m *Mesh) Hit(r *Ray, rayT Interval) (HitInfo, bool) {
+	return m.bvh.Hit(r, rayT)
+}
+
+func (m *Mesh) GetBounds() Aabb {
+	return m.bvh.GetBounds()
+}
@@ -0,0 +1,369 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+func approxEqual(a, b, eps float32) bool {
+	return AbsF32(a-b) <= eps
+}
+
+func approxEqualVec3(a, b Vec3, eps float32) bool {
+	return approxEqual(a.X, b.X, eps) && approxEqual(a.Y, b.Y, eps) && approxEqual(a.Z, b.Z, eps)
+}
+
+var unbounded = Interval{min: 0.001, max: float32(math.Inf(1))}
+
+func TestSphereHit(t *testing.T) {
+	mat := NewLambertian(NewSolidColor(1, 1, 1))
+	s := NewSphere(NewVec3(0, 0, -5), 1, &mat)
+
+	tests := []struct {
+		name      string
+		ray       *Ray
+		rayT      Interval
+		ok        bool
+		t         float32
+		normal    Vec3
+		frontFace bool
+	}{
+		{
+			name:      "head on",
+			ray:       NewRay(NewVec3Zero(), NewVec3(0, 0, -1), 0, nil),
+			rayT:      unbounded,
+			ok:        true,
+			t:         4,
+			normal:    NewVec3(0, 0, 1),
+			frontFace: true,
+		},
+		{
+			name:      "unnormalized direction",
+			ray:       NewRay(NewVec3Zero(), NewVec3(0, 0, -2), 0, nil),
+			rayT:      unbounded,
+			ok:        true,
+			t:         2,
+			normal:    NewVec3(0, 0, 1),
+			frontFace: true,
+		},
+		{
+			name:      "from inside",
+			ray:       NewRay(NewVec3(0, 0, -5), NewVec3(1, 0, 0), 0, nil),
+			rayT:      unbounded,
+			ok:        true,
+			t:         1,
+			normal:    NewVec3(-1, 0, 0),
+			frontFace: false,
+		},
+		{
+			name: "miss",
+			ray:  NewRay(NewVec3Zero(), NewVec3(0, 1, 0), 0, nil),
+			rayT: unbounded,
+		},
+		{
+			name: "behind the origin",
+			ray:  NewRay(NewVec3Zero(), NewVec3(0, 0, 1), 0, nil),
+			rayT: unbounded,
+		},
+		{
+			name: "beyond the interval",
+			ray:  NewRay(NewVec3Zero(), NewVec3(0, 0, -1), 0, nil),
+			rayT: Interval{min: 0.001, max: 3},
+		},
+		{
+			name:      "far side when the near side is outside the interval",
+			ray:       NewRay(NewVec3Zero(), NewVec3(0, 0, -1), 0, nil),
+			rayT:      Interval{min: 5, max: 10},
+			ok:        true,
+			t:         6,
+			normal:    NewVec3(0, 0, 1),
+			frontFace: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hi, ok := s.Hit(tt.ray, tt.rayT)
+			if ok != tt.ok {
+				t.Fatalf("hit = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if !approxEqual(hi.t, tt.t, 1e-4) {
+				t.Errorf("t = %v, want %v", hi.t, tt.t)
+			}
+			if !approxEqualVec3(hi.normal, tt.normal, 1e-4) {
+				t.Errorf("normal = %v, want %v", hi.normal, tt.normal)
+			}
+			if hi.frontFace != tt.frontFace {
+				t.Errorf("frontFace = %v, want %v", hi.frontFace, tt.frontFace)
+			}
+			if !approxEqualVec3(hi.point, tt.ray.At(hi.t), 1e-4) {
+				t.Errorf("point = %v, want the ray at t %v", hi.point, tt.ray.At(hi.t))
+			}
+		})
+	}
+}
+
+func TestMovingSphereHit(t *testing.T) {
+	mat := NewLambertian(NewSolidColor(1, 1, 1))
+	center0, center1 := NewVec3(0, 0, -5), NewVec3(2, -3, -5)
+	s := NewMovingSphere(center0, center1, 0, 1, 1, &mat)
+
+	tests := []struct {
+		name   string
+		ray    *Ray
+		ok     bool
+		center Vec3
+	}{
+		{"first center at time 0", NewRay(NewVec3(0, 0, 0), NewVec3(0, 0, -1), 0, nil), true, center0},
+		{"second center at time 1", NewRay(NewVec3(2, -3, 0), NewVec3(0, 0, -1), 1, nil), true, center1},
+		{"halfway at time 0.5", NewRay(NewVec3(1, -1.5, 0), NewVec3(0, 0, -1), 0.5, nil), true, NewVec3(1, -1.5, -5)},
+		{"first center at time 1", NewRay(NewVec3(0, 0, 0), NewVec3(0, 0, -1), 1, nil), false, Vec3{}},
+		{"second center at time 0", NewRay(NewVec3(2, -3, 0), NewVec3(0, 0, -1), 0, nil), false, Vec3{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hi, ok := s.Hit(tt.ray, unbounded)
+			if ok != tt.ok {
+				t.Fatalf("hit = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			// Straight at the center, so the ray meets the sphere one radius in front of it
+			if want := Add(tt.center, NewVec3(0, 0, 1)); !approxEqualVec3(hi.point, want, 1e-4) {
+				t.Errorf("point = %v, want %v", hi.point, want)
+			}
+			if !approxEqualVec3(hi.normal, NewVec3(0, 0, 1), 1e-4) {
+				t.Errorf("normal = %v, want it facing the ray", hi.normal)
+			}
+		})
+	}
+
+	b := s.GetBounds()
+	wantMin, wantMax := NewVec3(-1, -4, -6), NewVec3(3, 1, -4)
+	if gotMin, gotMax := NewVec3(b.x.min, b.y.min, b.z.min), NewVec3(b.x.max, b.y.max, b.z.max); gotMin != wantMin || gotMax != wantMax {
+		t.Errorf("bounds from %v to %v, want %v to %v around both ends of the path", gotMin, gotMax, wantMin, wantMax)
+	}
+}
+
+func TestQuadHit(t *testing.T) {
+	mat := NewLambertian(NewSolidColor(1, 1, 1))
+	q := NewQuad(NewVec3(-1, -1, -3), NewVec3(2, 0, 0), NewVec3(0, 4, 0), &mat)
+
+	tests := []struct {
+		name   string
+		ray    *Ray
+		ok     bool
+		t      float32
+		u      float32
+		v      float32
+		normal Vec3
+	}{
+		{
+			name:   "center",
+			ray:    NewRay(NewVec3Zero(), NewVec3(0, 0, -1), 0, nil),
+			ok:     true,
+			t:      3,
+			u:      0.5,
+			v:      0.25,
+			normal: NewVec3(0, 0, 1),
+		},
+		{
+			name:   "near a corner",
+			ray:    NewRay(NewVec3(0.9, 2.9, 0), NewVec3(0, 0, -1), 0, nil),
+			ok:     true,
+			t:      3,
+			u:      0.95,
+			v:      0.975,
+			normal: NewVec3(0, 0, 1),
+		},
+		{
+			name:   "from behind",
+			ray:    NewRay(NewVec3(0, 0, -6), NewVec3(0, 0, 1), 0, nil),
+			ok:     true,
+			t:      3,
+			u:      0.5,
+			v:      0.25,
+			normal: NewVec3(0, 0, -1),
+		},
+		{
+			name: "outside the edges",
+			ray:  NewRay(NewVec3(1.5, 0, 0), NewVec3(0, 0, -1), 0, nil),
+		},
+		{
+			name: "parallel",
+			ray:  NewRay(NewVec3(0, 0, -3), NewVec3(1, 0, 0), 0, nil),
+		},
+		{
+			name: "away from the plane",
+			ray:  NewRay(NewVec3Zero(), NewVec3(0, 0, 1), 0, nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hi, ok := q.Hit(tt.ray, unbounded)
+			if ok != tt.ok {
+				t.Fatalf("hit = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if !approxEqual(hi.t, tt.t, 1e-4) {
+				t.Errorf("t = %v, want %v", hi.t, tt.t)
+			}
+			if !approxEqual(hi.u, tt.u, 1e-4) || !approxEqual(hi.v, tt.v, 1e-4) {
+				t.Errorf("uv = (%v, %v), want (%v, %v)", hi.u, hi.v, tt.u, tt.v)
+			}
+			if !approxEqualVec3(hi.normal, tt.normal, 1e-4) {
+				t.Errorf("normal = %v, want %v", hi.normal, tt.normal)
+			}
+		})
+	}
+}
+
+func TestTriangleHit(t *testing.T) {
+	mat := NewLambertian(NewSolidColor(1, 1, 1))
+	p0, p1, p2 := NewVec3(-1, -1, -3), NewVec3(3, -1, -3), NewVec3(-1, 3, -3)
+	flat := NewTriangle(p0, p1, p2, &mat)
+	n0, n1, n2 := NewVec3(0, 0, 1), Unit(NewVec3(1, 0, 1)), Unit(NewVec3(0, 1, 1))
+	smooth := NewTriangle(p0, p1, p2, &mat, WithVertexNormals(n0, n1, n2))
+	// Barycentrics (0.375, 0.25, 0.375) at (0, 0.5, -3)
+	interpolated := Unit(Add(Add(Scale(n0, 0.375), Scale(n1, 0.25)), Scale(n2, 0.375)))
+	// All three corners on one line, and two corners in the same place
+	collinear := NewTriangle(NewVec3(0, 0, -3), NewVec3(1, 0, -3), NewVec3(2, 0, -3), &mat)
+	collapsed := NewTriangle(NewVec3(0, 0, -3), NewVec3(0, 0, -3), NewVec3(1, 1, -3), &mat)
+
+	tests := []struct {
+		name   string
+		tri    *Triangle
+		ray    *Ray
+		ok     bool
+		t      float32
+		u      float32
+		v      float32
+		normal Vec3
+	}{
+		{
+			name:   "barycentrics",
+			tri:    flat,
+			ray:    NewRay(NewVec3(0, 0.5, 0), NewVec3(0, 0, -1), 0, nil),
+			ok:     true,
+			t:      3,
+			u:      0.25,
+			v:      0.375,
+			normal: NewVec3(0, 0, 1),
+		},
+		{
+			name:   "from behind",
+			tri:    flat,
+			ray:    NewRay(NewVec3(0, 0.5, -6), NewVec3(0, 0, 1), 0, nil),
+			ok:     true,
+			t:      3,
+			u:      0.25,
+			v:      0.375,
+			normal: NewVec3(0, 0, -1),
+		},
+		{
+			name:   "vertex normals",
+			tri:    smooth,
+			ray:    NewRay(NewVec3(0, 0.5, 0), NewVec3(0, 0, -1), 0, nil),
+			ok:     true,
+			t:      3,
+			u:      0.25,
+			v:      0.375,
+			normal: interpolated,
+		},
+		{
+			name:   "vertex normals from behind",
+			tri:    smooth,
+			ray:    NewRay(NewVec3(0, 0.5, -6), NewVec3(0, 0, 1), 0, nil),
+			ok:     true,
+			t:      3,
+			u:      0.25,
+			v:      0.375,
+			normal: Scale(interpolated, -1),
+		},
+		{
+			name:   "just inside the long edge",
+			tri:    flat,
+			ray:    NewRay(NewVec3(0.99, 1, 0), NewVec3(0, 0, -1), 0, nil),
+			ok:     true,
+			t:      3,
+			u:      0.4975,
+			v:      0.5,
+			normal: NewVec3(0, 0, 1),
+		},
+		{
+			name: "just outside the long edge",
+			tri:  flat,
+			ray:  NewRay(NewVec3(1.01, 1, 0), NewVec3(0, 0, -1), 0, nil),
+		},
+		{
+			name: "just outside the bottom edge",
+			tri:  flat,
+			ray:  NewRay(NewVec3(0, -1.01, 0), NewVec3(0, 0, -1), 0, nil),
+		},
+		{
+			name: "just outside the left edge",
+			tri:  flat,
+			ray:  NewRay(NewVec3(-1.01, 0, 0), NewVec3(0, 0, -1), 0, nil),
+		},
+		{
+			name: "parallel in the plane",
+			tri:  flat,
+			ray:  NewRay(NewVec3(-5, 0, -3), NewVec3(1, 0, 0), 0, nil),
+		},
+		{
+			name: "parallel above the plane",
+			tri:  flat,
+			ray:  NewRay(NewVec3(-5, 0, -2.9), NewVec3(1, 0.2, 0), 0, nil),
+		},
+		{
+			name: "collinear corners",
+			tri:  collinear,
+			ray:  NewRay(NewVec3(1, 0, 0), NewVec3(0, 0, -1), 0, nil),
+		},
+		{
+			name: "coincident corners",
+			tri:  collapsed,
+			ray:  NewRay(NewVec3(0.5, 0.5, 0), NewVec3(0, 0, -1), 0, nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hi, ok := tt.tri.Hit(tt.ray, unbounded)
+			if ok != tt.ok {
+				t.Fatalf("hit = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if !approxEqual(hi.t, tt.t, 1e-4) {
+				t.Errorf("t = %v, want %v", hi.t, tt.t)
+			}
+			if !approxEqual(hi.u, tt.u, 1e-4) || !approxEqual(hi.v, tt.v, 1e-4) {
+				t.Errorf("uv = (%v, %v), want (%v, %v)", hi.u, hi.v, tt.u, tt.v)
+			}
+			if !approxEqualVec3(hi.normal, tt.normal, 1e-4) {
+				t.Errorf("normal = %v, want %v", hi.normal, tt.normal)
+			}
+		})
+	}
+}
+
+func TestQuadBoundsCoverEveryCorner(t *testing.T) {
+	mat := NewLambertian(NewSolidColor(1, 1, 1))
+	q := NewQuad(NewVec3(0, 0, 0), NewVec3(1, 1, 0), NewVec3(1, -1, 1), &mat)
+	b := q.GetBounds()
+
+	for _, corner := range []Vec3{q.Q, Add(q.Q, q.u), Add(q.Q, q.v), Add(q.Q, Add(q.u, q.v))} {
+		if !b.x.In(corner.X, 1e-6) || !b.y.In(corner.Y, 1e-6) || !b.z.In(corner.Z, 1e-6) {
+			t.Errorf("corner %v is outside the bounds %v", corner, b)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// Framebuffer holds the linear radiance of every pixel of a rendered image, or the values of an AOV
+type Framebuffer struct {
+	width   int
+	height  int
+	pixels  []Vec3
+	display DisplayFunc
+}
+
+// DisplayFunc maps a stored value into a color from 0 to 1 for 8 bit image formats. Floating point formats
+// store the values untouched.
+type DisplayFunc func(col Vec3) Vec3
+
+// DisplayLinear shows values as they are
+func DisplayLinear(col Vec3) Vec3 {
+	return col
+}
+
+func NewFramebuffer(width, height int) *Framebuffer {
+	return &Framebuffer{
+		width:   width,
+		height:  height,
+		pixels:  make([]Vec3, width*height),
+		display: DisplaySRGB,
+	}
+}
+
+// SetDisplay changes how ToRGBA shows the stored values. The default is DisplaySRGB.
+func (fb *Framebuffer) SetDisplay(fn DisplayFunc) {
+	fb.display = fn
+}
+
+func (fb *Framebuffer) Width() int {
+	return fb.width
+}
+
+func (fb *Framebuffer) Height() int {
+	return fb.height
+}
+
+func (fb *Framebuffer) Set(i, j int, col Vec3) {
+	fb.pixels[j*fb.width+i] = col
+}
+
+func (fb *Framebuffer) At(i, j int) Vec3 {
+	return fb.pixels[j*fb.width+i]
+}
+
+// ToRGBA maps the framebuffer through its DisplayFunc and quantizes it into an 8 bit image
+func (fb *Framebuffer) ToRGBA() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, fb.width, fb.height))
+	for j := 0; j < fb.height; j++ {
+		for i := 0; i < fb.width; i++ {
+			col := fb.display(fb.At(i, j))
+			col.ToRGB()
+			img.SetRGBA(i, j, color.RGBA{R: uint8(col.X), G: uint8(col.Y), B: uint8(col.Z), A: 255})
+		}
+	}
+	return img
+}
+
+// ImageEncoder writes a finished framebuffer in some image format
+type ImageEncoder interface {
+	Encode(w io.Writer, fb *Framebuffer) error
+}
+
+type PNGEncoder struct{}
+
+func NewPNGEncoder() PNGEncoder {
+	return PNGEncoder{}
+}
+
+func (e PNGEncoder) Encode(w io.Writer, fb *Framebuffer) error {
+	return png.Encode(w, fb.ToRGBA())
+}
+
+type PPMEncoder struct {
+	binary bool
+}
+
+// NewP3Encoder writes ASCII PPM
+func NewP3Encoder() PPMEncoder {
+	return PPMEncoder{binary: false}
+}
+
+// NewP6Encoder writes binary PPM
+func NewP6Encoder() PPMEncoder {
+	return PPMEncoder{binary: true}
+}
+
+func (e PPMEncoder) Encode(w io.Writer, fb *Framebuffer) error {
+	img := fb.ToRGBA()
+	bw := bufio.NewWriter(w)
+
+	magic := "P3"
+	if e.binary {
+		magic = "P6"
+	}
+	if _, err := fmt.Fprintf(bw, "%s\n%d %d\n255\n", magic, fb.width, fb.height); err != nil {
+		return err
+	}
+
+	for j := 0; j < fb.height; j++ {
+		for i := 0; i < fb.width; i++ {
+			p := img.RGBAAt(i, j)
+			var err error
+			if e.binary {
+				_, err = bw.Write([]byte{p.R, p.G, p.B})
+			} else {
+				_, err = fmt.Fprintf(bw, "%d %d %d\n", p.R, p.G, p.B)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// PFMEncoder writes the linear framebuffer as 32 bit floats in the Portable Float Map format
+type PFMEncoder struct{}
+
+func NewPFMEncoder() PFMEncoder {
+	return PFMEncoder{}
+}
+
+func (e PFMEncoder) Encode(w io.Writer, fb *Framebuffer) error {
+	bw := bufio.NewWriter(w)
+
+	// A negative scale marks the data as little endian
+	if _, err := fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", fb.width, fb.height); err != nil {
+		return err
+	}
+
+	// PFM scanlines are stored bottom to top
+	row := make([]float32, 3*fb.width)
+	for j := fb.height - 1; j >= 0; j-- {
+		for i := 0; i < fb.width; i++ {
+			col := fb.At(i, j)
+			row[3*i] = col.X
+			row[3*i+1] = col.Y
+			row[3*i+2] = col.Z
+		}
+		if err := binary.Write(bw, binary.LittleEndian, row); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// HDREncoder writes the linear framebuffer as Radiance RGBE
+type HDREncoder struct{}
+
+func NewHDREncoder() HDREncoder {
+	return HDREncoder{}
+}
+
+func (e HDREncoder) Encode(w io.Writer, fb *Framebuffer) error {
+	bw := bufio.NewWriter(w)
+
+	if _, err := fmt.Fprintf(bw, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", fb.height, fb.width); err != nil {
+		return err
+	}
+
+	// Scanlines are written flat, without run length encoding, which every reader accepts
+	row := make([]byte, 4*fb.width)
+	for j := 0; j < fb.height; j++ {
+		for i := 0; i < fb.width; i++ {
+			rgbe := ToRGBE(fb.At(i, j))
+			copy(row[4*i:], rgbe[:])
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ToRGBE packs a linear color into a shared exponent RGBE pixel
+func ToRGBE(col Vec3) [4]byte {
+	v := MaxF32(col.X, MaxF32(col.Y, col.Z))
+	if v < 1e-32 {
+		return [4]byte{}
+	}
+
+	m, e := math.Frexp(float64(v))
+	scale := float32(m * 256.0 / float64(v))
+
+	return [4]byte{
+		byte(MaxF32(col.X, 0) * scale),
+		byte(MaxF32(col.Y, 0) * scale),
+		byte(MaxF32(col.Z, 0) * scale),
+		byte(e + 128),
+	}
+}
+
+// FromRGBE unpacks a shared exponent RGBE pixel into a linear color
+func FromRGBE(rgbe [4]byte) Vec3 {
+	if rgbe[3] == 0 {
+		return NewVec3Zero()
+	}
+	f := float32(math.Ldexp(1, int(rgbe[3])-(128+8)))
+	return NewVec3(float32(rgbe[0])*f, float32(rgbe[1])*f, float32(rgbe[2])*f)
+}
+
+// DecodeHDR reads a Radiance RGBE image with flat or run length encoded scanlines. Only the common
+// "-Y height +X width" orientation is supported.
+func DecodeHDR(r io.Reader) (*Framebuffer, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading hdr header: %w", err)
+	}
+	if !strings.HasPrefix(magic, "#?") {
+		return nil, fmt.Errorf("not a radiance hdr file")
+	}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("reading hdr header: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if format, ok := strings.CutPrefix(line, "FORMAT="); ok && format != "32-bit_rle_rgbe" {
+			return nil, fmt.Errorf("unsupported hdr format %q", format)
+		}
+	}
+
+	var width, height int
+	resolution, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading hdr resolution: %w", err)
+	}
+	if _, err = fmt.Sscanf(resolution, "-Y %d +X %d", &height, &width); err != nil {
+		return nil, fmt.Errorf("unsupported hdr resolution %q", strings.TrimSpace(resolution))
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid hdr size %dx%d", width, height)
+	}
+
+	fb := NewFramebuffer(width, height)
+	row := make([]byte, 4*width)
+	for j := 0; j < height; j++ {
+		if err = readHDRScanline(br, row, width); err != nil {
+			return nil, fmt.Errorf("reading hdr scanline %d: %w", j, err)
+		}
+		for i := 0; i < width; i++ {
+			fb.Set(i, j, FromRGBE([4]byte(row[4*i:4*i+4])))
+		}
+	}
+
+	return fb, nil
+}
+
+// readHDRScanline fills row with width RGBE pixels. Run length encoded scanlines start with 2, 2 and the
+// width, then hold each of the four components separately as runs and literal spans.
+func readHDRScanline(br *bufio.Reader, row []byte, width int) error {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return err
+	}
+	if width < 8 || width > 0x7fff || head[0] != 2 || head[1] != 2 || head[2]&0x80 != 0 {
+		copy(row, head)
+		_, err := io.ReadFull(br, row[4:])
+		return err
+	}
+	if int(head[2])<<8|int(head[3]) != width {
+		return fmt.Errorf("scanline width does not match the image width")
+	}
+
+	for c := 0; c < 4; c++ {
+		for i := 0; i < width; {
+			count, err := br.ReadByte()
+			if err != nil {
+				return err
+			}
+			if count > 128 {
+				n := int(count) - 128
+				val, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+				if i+n > width {
+					return fmt.Errorf("run overflows the scanline")
+				}
+				for ; n > 0; n-- {
+					row[4*i+c] = val
+					i++
+				}
+			} else {
+				n := int(count)
+				if n == 0 || i+n > width {
+					return fmt.Errorf("invalid literal span of %d", n)
+				}
+				for ; n > 0; n-- {
+					val, err := br.ReadByte()
+					if err != nil {
+						return err
+					}
+					row[4*i+c] = val
+					i++
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// DecodePFM reads a color or grayscale Portable Float Map of either endianness
+func DecodePFM(r io.Reader) (*Framebuffer, error) {
+	br := bufio.NewReader(r)
+
+	var magic string
+	var width, height int
+	var scale float64
+	if _, err := fmt.Fscan(br, &magic, &width, &height, &scale); err != nil {
+		return nil, fmt.Errorf("reading pfm header: %w", err)
+	}
+	// A single whitespace character separates the header from the data
+	if _, err := br.ReadByte(); err != nil {
+		return nil, fmt.Errorf("reading pfm header: %w", err)
+	}
+
+	channels := 0
+	switch magic {
+	case "PF":
+		channels = 3
+	case "Pf":
+		channels = 1
+	default:
+		return nil, fmt.Errorf("not a pfm file")
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid pfm size %dx%d", width, height)
+	}
+
+	var order binary.ByteOrder = binary.BigEndian
+	if scale < 0 {
+		order = binary.LittleEndian
+	}
+
+	fb := NewFramebuffer(width, height)
+	row := make([]float32, channels*width)
+	for j := height - 1; j >= 0; j-- {
+		if err := binary.Read(br, order, row); err != nil {
+			return nil, fmt.Errorf("reading pfm scanline: %w", err)
+		}
+		for i := 0; i < width; i++ {
+			if channels == 1 {
+				fb.Set(i, j, NewVec3(row[i], row[i], row[i]))
+			} else {
+				fb.Set(i, j, NewVec3(row[3*i], row[3*i+1], row[3*i+2]))
+			}
+		}
+	}
+
+	return fb, nil
+}
+
+// NewImageEncoderFromFile picks an encoder based on the extension of fname.
+// ".png" is PNG, ".ppm" and ".p3.ppm" are ASCII P3 and ".p6.ppm" is binary P6. ".pfm" and ".hdr" keep
+// the linear radiance as floating point PFM and Radiance RGBE.
+func NewImageEncoderFromFile(fname string) (ImageEncoder, error) {
+	lower := strings.ToLower(fname)
+	if strings.HasSuffix(lower, ".p6.ppm") {
+		return NewP6Encoder(), nil
+	}
+
+	switch ext := filepath.Ext(lower); ext {
+	case ".png":
+		return NewPNGEncoder(), nil
+	case ".ppm":
+		return NewP3Encoder(), nil
+	case ".pfm":
+		return NewPFMEncoder(), nil
+	case ".hdr":
+		return NewHDREncoder(), nil
+	default:
+		return nil, fmt.Errorf("no image encoder for extension %q", ext)
+	}
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// testRadiance is a small image with black, dim, bright and saturated pixels of unequal channels
+func testRadiance() *Framebuffer {
+	fb := NewFramebuffer(5, 3)
+	values := []Vec3{
+		NewVec3(0, 0, 0),
+		NewVec3(0.001, 0.002, 0.003),
+		NewVec3(0.18, 0.5, 0.9),
+		NewVec3(1, 1, 1),
+		NewVec3(12.5, 3, 0.25),
+		NewVec3(1000, 0, 40),
+	}
+	for j := 0; j < fb.Height(); j++ {
+		for i := 0; i < fb.Width(); i++ {
+			fb.Set(i, j, values[(i+2*j)%len(values)])
+		}
+	}
+	return fb
+}
+
+func TestPFMRoundTrip(t *testing.T) {
+	want := testRadiance()
+	var buf bytes.Buffer
+	if err := NewPFMEncoder().Encode(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodePFM(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Width() != want.Width() || got.Height() != want.Height() {
+		t.Fatalf("decoded %dx%d, want %dx%d", got.Width(), got.Height(), want.Width(), want.Height())
+	}
+	for j := 0; j < want.Height(); j++ {
+		for i := 0; i < want.Width(); i++ {
+			if got.At(i, j) != want.At(i, j) {
+				t.Errorf("pixel (%d, %d) is %v, want %v", i, j, got.At(i, j), want.At(i, j))
+			}
+		}
+	}
+}
+
+// TestHDRRoundTrip allows for the 8 bit mantissas of RGBE, which keep every channel to within 1/128 of the
+// brightest channel of its pixel
+func TestHDRRoundTrip(t *testing.T) {
+	want := testRadiance()
+	var buf bytes.Buffer
+	if err := NewHDREncoder().Encode(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeHDR(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Width() != want.Width() || got.Height() != want.Height() {
+		t.Fatalf("decoded %dx%d, want %dx%d", got.Width(), got.Height(), want.Width(), want.Height())
+	}
+	for j := 0; j < want.Height(); j++ {
+		for i := 0; i < want.Width(); i++ {
+			w := want.At(i, j)
+			eps := MaxF32(w.X, MaxF32(w.Y, w.Z)) / 128
+			if !approxEqualVec3(got.At(i, j), w, eps) {
+				t.Errorf("pixel (%d, %d) is %v, want %v", i, j, got.At(i, j), w)
+			}
+		}
+	}
+}
+
+func TestDecodeHDRRunLengthEncoded(t *testing.T) {
+	f, err := os.Open("testdata/hdr/rle.hdr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fb, err := DecodeHDR(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first scanline is run length encoded, the second flat
+	red := []byte{10, 10, 10, 10, 20, 30, 40, 50}
+	for i := 0; i < 8; i++ {
+		want := FromRGBE([4]byte{red[i], 128, byte(i), 129})
+		if got := fb.At(i, 0); got != want {
+			t.Errorf("pixel (%d, 0) is %v, want %v", i, got, want)
+		}
+		want = FromRGBE([4]byte{64, 32, 16, 130})
+		if got := fb.At(i, 1); got != want {
+			t.Errorf("pixel (%d, 1) is %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestImageEncoderFromFile(t *testing.T) {
+	tests := []struct {
+		fname string
+		magic string
+	}{
+		{"out/img.ppm", "P3\n"},
+		{"out/img.p3.ppm", "P3\n"},
+		{"out/img.p6.ppm", "P6\n"},
+		{"out/IMG.P6.PPM", "P6\n"},
+		{"out/img.png", "\x89PNG"},
+		{"out/img.pfm", "PF\n"},
+		{"out/img.hdr", "#?RADIANCE"},
+	}
+	for _, tt := range tests {
+		enc, err := NewImageEncoderFromFile(tt.fname)
+		if err != nil {
+			t.Errorf("%s: %v", tt.fname, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := enc.Encode(&buf, NewFramebuffer(1, 1)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), []byte(tt.magic)) {
+			t.Errorf("%s starts with %q, want %q", tt.fname, buf.Bytes()[:min(buf.Len(), len(tt.magic))], tt.magic)
+		}
+	}
+	if _, err := NewImageEncoderFromFile("out/img.gif"); err == nil {
+		t.Error("out/img.gif did not fail")
+	}
+}
@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"math"
+)
+
+// Emitter is something that can be aimed at directly when looking for light
+type Emitter interface {
+	// PDFValue is the solid angle density with which Random produces dir from origin
+	PDFValue(origin, dir Vec3) float32
+	// Random gives a direction from origin towards a random point on the emitter
+	Random(origin Vec3, s Sampler) Vec3
+}
+
+// emissiveHittable is a primitive that World.Add recognises as a light when its material emits
+type emissiveHittable interface {
+	Hittable
+	Emitter
+	GetMaterial() Material
+}
+
+// LightList is the set of emitters used for light sampling. Sampling picks an emitter uniformly so the density
+// of a direction is the average of every emitter's density.
+type LightList struct {
+	emitters []Emitter
+}
+
+func NewLightList() *LightList {
+	return &LightList{}
+}
+
+func (l *LightList) Add(e Emitter) {
+	l.emitters = append(l.emitters, e)
+}
+
+// Merge adds every emitter of other
+func (l *LightList) Merge(other *LightList) {
+	if other == nil {
+		return
+	}
+	l.emitters = append(l.emitters, other.emitters...)
+}
+
+func (l *LightList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.emitters)
+}
+
+func (l *LightList) PDFValue(origin, dir Vec3) float32 {
+	sum := float32(0)
+	for _, e := range l.emitters {
+		sum += e.PDFValue(origin, dir)
+	}
+	return sum / float32(len(l.emitters))
+}
+
+func (l *LightList) Random(origin Vec3, s Sampler) Vec3 {
+	k := min(int(s.Get1D()*float32(len(l.emitters))), len(l.emitters)-1)
+	return l.emitters[k].Random(origin, s)
+}
+
+// isEmissive reports whether mat gives off light
+func isEmissive(mat Material) bool {
+	switch mat.(type) {
+	case DiffuseLight, *DiffuseLight:
+		return true
+	}
+	return false
+}
+
+// emittersOf finds the lights in h: emissive primitives, the emissive triangles of a mesh, the lights of a world
+// or BVH and those inside a Transform, sampled through it. Lights that move with time, a MovingSphere or
+// anything under a MovingTransform, are not included as an Emitter has no time to place them at. They still
+// light the scene when scattered rays happen to hit them.
+func emittersOf(h Hittable) []Emitter {
+	switch h := h.(type) {
+	case interface{ Lights() *LightList }:
+		if l := h.Lights(); l != nil {
+			return l.emitters
+		}
+	case *Mesh:
+		var emitters []Emitter
+		for _, tri := range h.triangles {
+			emitters = append(emitters, emittersOf(tri)...)
+		}
+		return emitters
+	case *Transform:
+		inner := emittersOf(h.object)
+		emitters := make([]Emitter, len(inner))
+		for i, e := range inner {
+			emitters[i] = newTransformedEmitter(e, h)
+		}
+		return emitters
+	case emissiveHittable:
+		if isEmissive(h.GetMaterial()) {
+			return []Emitter{h}
+		}
+	}
+	return nil
+}
+
+// LightsOf finds the lights of a world or a BVH built from one
+func LightsOf(h Hittable) *LightList {
+	if lh, ok := h.(interface{ Lights() *LightList }); ok {
+		return lh.Lights()
+	}
+	return nil
+}
+
+func (s *Sphere) GetMaterial() Material {
+	return s.Material
+}
+
+// PDFValue is uniform over the cone of directions from origin that hit the sphere
+func (s *Sphere) PDFValue(origin, dir Vec3) float32 {
+	if _, ok := s.Hit(NewRay(origin, dir, 0, nil), Interval{min: 0.001, max: float32(math.Inf(1))}); !ok {
+		return 0
+	}
+
+	toCenter := Sub(s.Center, origin)
+	distSq := toCenter.LenSq()
+	if distSq <= s.Radius*s.Radius {
+		return 0
+	}
+	cosThetaMax := float32(math.Sqrt(float64(1 - s.Radius*s.Radius/distSq)))
+	solidAngle := 2 * PiF32 * (1 - cosThetaMax)
+
+	return 1 / solidAngle
+}
+
+func (s *Sphere) Random(origin Vec3, sampler Sampler) Vec3 {
+	toCenter := Sub(s.Center, origin)
+	distSq := toCenter.LenSq()
+	if distSq <= s.Radius*s.Radius {
+		return sampleUniformSphere(sampler.Get2D())
+	}
+
+	cosThetaMax := float32(math.Sqrt(float64(1 - s.Radius*s.Radius/distSq)))
+	return NewONB(toCenter).Local(randomInCone(cosThetaMax, sampler))
+}
+
+func (q Quad) GetMaterial() Material {
+	return q.material
+}
+
+// PDFValue converts the uniform density over the quad's area into a density over solid angle from origin
+func (q Quad) PDFValue(origin, dir Vec3) float32 {
+	hi, ok := q.Hit(NewRay(origin, dir, 0, nil), Interval{min: 0.001, max: float32(math.Inf(1))})
+	if !ok {
+		return 0
+	}
+
+	distSq := hi.t * hi.t * dir.LenSq()
+	cosine := AbsF32(Dot(dir, q.normal) / dir.Len())
+	if cosine < 1e-8 {
+		return 0
+	}
+
+	return distSq / (cosine * q.area)
+}
+
+func (q Quad) Random(origin Vec3, s Sampler) Vec3 {
+	a, b := s.Get2D()
+	p := Add(q.Q, Add(Scale(q.u, a), Scale(q.v, b)))
+	return Sub(p, origin)
+}
+
+func (t *Triangle) GetMaterial() Material {
+	return t.material
+}
+
+// PDFValue converts the uniform density over the triangle's area into a density over solid angle from origin
+func (t *Triangle) PDFValue(origin, dir Vec3) float32 {
+	hi, ok := t.Hit(NewRay(origin, dir, 0, nil), Interval{min: 0.001, max: float32(math.Inf(1))})
+	if !ok {
+		return 0
+	}
+
+	distSq := hi.t * hi.t * dir.LenSq()
+	cosine := AbsF32(Dot(dir, t.normal) / dir.Len())
+	if cosine < 1e-8 {
+		return 0
+	}
+
+	return distSq / (cosine * t.area)
+}
+
+// Random picks a point uniformly over the triangle, the square root keeps the density from bunching up at p0
+func (t *Triangle) Random(origin Vec3, s Sampler) Vec3 {
+	a, b := s.Get2D()
+	su := float32(math.Sqrt(float64(a)))
+	p := Add(t.p0, Add(Scale(t.e1, su*(1-b)), Scale(t.e2, su*b)))
+	return Sub(p, origin)
+}
+
+// transformedEmitter samples a light inside a Transform in the object's space and maps the direction back. A
+// linear map A from world to object directions stretches solid angle by |det A| / |Aω|³ at a unit direction ω,
+// which PDFValue applies so scaled lights keep a correct density.
+type transformedEmitter struct {
+	emitter Emitter
+	tr      *Transform
+	det     float32
+}
+
+func newTransformedEmitter(e Emitter, tr *Transform) transformedEmitter {
+	return transformedEmitter{
+		emitter: e,
+		tr:      tr,
+		det:     AbsF32(tr.toObject.Det3()),
+	}
+}
+
+func (te transformedEmitter) PDFValue(origin, dir Vec3) float32 {
+	objDir := te.tr.toObject.MulDir(dir)
+	pdf := te.emitter.PDFValue(te.tr.toObject.MulPoint(origin), objDir)
+	if pdf == 0 {
+		return 0
+	}
+
+	stretch := dir.Len() / objDir.Len()
+	return pdf * te.det * stretch * stretch * stretch
+}
+
+func (te transformedEmitter) Random(origin Vec3, s Sampler) Vec3 {
+	return te.tr.toWorld.MulDir(te.emitter.Random(te.tr.toObject.MulPoint(origin), s))
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWorldCollectsLights(t *testing.T) {
+	light := NewDiffuseLight(NewSolidColor(4, 4, 4))
+	white := NewLambertian(NewSolidColor(1, 1, 1))
+
+	nested := NewWorld()
+	nested.Add(NewQuad(NewVec3(0, 5, 0), NewVec3(1, 0, 0), NewVec3(0, 0, 1), &light))
+
+	// Like an OBJ mesh where only the faces with an Ke emit
+	mesh := NewMesh([]Hittable{
+		NewTriangle(NewVec3(0, 0, 0), NewVec3(1, 0, 0), NewVec3(0, 1, 0), &light),
+		NewTriangle(NewVec3(1, 0, 0), NewVec3(1, 1, 0), NewVec3(0, 1, 0), &light),
+		NewTriangle(NewVec3(0, 0, 1), NewVec3(1, 0, 1), NewVec3(0, 1, 1), &white),
+	})
+
+	world := NewWorld()
+	world.Add(NewSphere(NewVec3(0, 0, -5), 1, &light))
+	world.Add(NewSphere(NewVec3(0, 0, 5), 1, &white))
+	world.Add(NewTriangle(NewVec3(0, 3, 0), NewVec3(1, 3, 0), NewVec3(0, 3, 1), &light))
+	world.Add(mesh)
+	world.Add(NewTranslate(NewRotateY(nested, 30), NewVec3(2, 0, 0)))
+	world.Add(NewMovingSphere(NewVec3(3, 0, 0), NewVec3(3, 1, 0), 0, 1, 0.5, &light))
+
+	// The sphere, the triangle, two mesh faces and the transformed quad; the moving sphere is left out
+	if got := world.Lights().Len(); got != 5 {
+		t.Errorf("world has %d lights, want 5", got)
+	}
+	if got := NewBVHFromWorld(world).Lights().Len(); got != 5 {
+		t.Errorf("BVH has %d lights, want 5", got)
+	}
+}
+
+// TestTransformedEmitterMatchesPlacedQuad samples a quad through a transform that rotates and stretches it
+// unevenly. Its densities should be those of the same quad built directly in world space.
+func TestTransformedEmitterMatchesPlacedQuad(t *testing.T) {
+	light := NewDiffuseLight(NewSolidColor(1, 1, 1))
+	m := TRS{
+		Scale:     NewVec3(2, 1, 3),
+		Rotate:    NewVec3(10, 30, 0),
+		Translate: NewVec3(1, 2, -1),
+	}.Mat4()
+	tr := NewTransform(NewQuad(NewVec3(0, 0, 0), NewVec3(1, 0, 0), NewVec3(0, 0, 1), &light), m)
+	placed := NewQuad(m.MulPoint(NewVec3(0, 0, 0)), m.MulDir(NewVec3(1, 0, 0)), m.MulDir(NewVec3(0, 0, 1)), &light)
+
+	emitters := emittersOf(tr)
+	if len(emitters) != 1 {
+		t.Fatalf("found %d emitters in the transform, want 1", len(emitters))
+	}
+	e := emitters[0]
+
+	s := newSampler(SamplerIndependent, 1, 1)
+	for _, origin := range []Vec3{NewVec3(0, -3, 0), NewVec3(4, -1, 2), NewVec3(-2, 6, -3)} {
+		for k := 0; k < 20; k++ {
+			for _, dir := range []Vec3{e.Random(origin, s), placed.Random(origin, s)} {
+				want := placed.PDFValue(origin, dir)
+				got := e.PDFValue(origin, dir)
+				if want == 0 || !approxEqual(got/want, 1, 1e-3) {
+					t.Fatalf("from %v along %v: density %v, want %v", origin, dir, got, want)
+				}
+			}
+		}
+	}
+}
+
+// TestTriangleEmitterCoversSolidAngle averages 1/pdf over directions drawn by Random, which is the solid angle
+// the triangle covers when the samples are spread evenly over it and the density is right
+func TestTriangleEmitterCoversSolidAngle(t *testing.T) {
+	light := NewDiffuseLight(NewSolidColor(1, 1, 1))
+	p0, p1, p2 := NewVec3(-1, 2, -1), NewVec3(2, 2, 0), NewVec3(0, 3, 2)
+	tri := NewTriangle(p0, p1, p2, &light)
+	origin := NewVec3(0, 0, 0)
+
+	// Van Oosterom and Strackee's formula for the solid angle of a triangle
+	a, b, c := Sub(p0, origin), Sub(p1, origin), Sub(p2, origin)
+	la, lb, lc := a.Len(), b.Len(), c.Len()
+	numerator := AbsF32(Dot(a, Cross(b, c)))
+	denominator := la*lb*lc + Dot(a, b)*lc + Dot(a, c)*lb + Dot(b, c)*la
+	want := 2 * math.Atan2(float64(numerator), float64(denominator))
+
+	const n = 20000
+	s := newSampler(SamplerIndependent, 1, 1)
+	sum := 0.0
+	for k := 0; k < n; k++ {
+		pdf := tri.PDFValue(origin, tri.Random(origin, s))
+		if pdf <= 0 {
+			t.Fatalf("sample %d missed the triangle", k)
+		}
+		sum += 1 / float64(pdf)
+	}
+	if got := sum / n; math.Abs(got-want) > 0.02*want {
+		t.Errorf("solid angle %v, want %v", got, want)
+	}
+}
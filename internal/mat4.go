@@ -0,0 +1,167 @@
+package internal
+
+import (
+	"math"
+)
+
+// Mat4 is a row major 4x4 matrix that transforms column vectors, so MulMat4(a, b) applies b first
+type Mat4 [4][4]float32
+
+func NewMat4Identity() Mat4 {
+	return Mat4{
+		{1, 0, 0, 0},
+		{0, 1, 0, 0},
+		{0, 0, 1, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+func NewMat4Translate(offset Vec3) Mat4 {
+	m := NewMat4Identity()
+	m[0][3] = offset.X
+	m[1][3] = offset.Y
+	m[2][3] = offset.Z
+	return m
+}
+
+func NewMat4Scale(s Vec3) Mat4 {
+	m := NewMat4Identity()
+	m[0][0] = s.X
+	m[1][1] = s.Y
+	m[2][2] = s.Z
+	return m
+}
+
+// NewMat4Rotate rotates counter clockwise around axis when looking down the axis towards the origin
+func NewMat4Rotate(axis Vec3, degrees float32) Mat4 {
+	a := Unit(axis)
+	rad := float64(ToRadians(degrees))
+	sin := float32(math.Sin(rad))
+	cos := float32(math.Cos(rad))
+	t := 1 - cos
+
+	return Mat4{
+		{t*a.X*a.X + cos, t*a.X*a.Y - sin*a.Z, t*a.X*a.Z + sin*a.Y, 0},
+		{t*a.X*a.Y + sin*a.Z, t*a.Y*a.Y + cos, t*a.Y*a.Z - sin*a.X, 0},
+		{t*a.X*a.Z - sin*a.Y, t*a.Y*a.Z + sin*a.X, t*a.Z*a.Z + cos, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+// NewMat4EulerDegrees rotates around x, then y, then z
+func NewMat4EulerDegrees(degrees Vec3) Mat4 {
+	rx := NewMat4Rotate(NewVec3(1, 0, 0), degrees.X)
+	ry := NewMat4Rotate(NewVec3(0, 1, 0), degrees.Y)
+	rz := NewMat4Rotate(NewVec3(0, 0, 1), degrees.Z)
+	return MulMat4(rz, MulMat4(ry, rx))
+}
+
+func MulMat4(a, b Mat4) Mat4 {
+	var m Mat4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			for k := 0; k < 4; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+func (m Mat4) Transpose() Mat4 {
+	var t Mat4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			t[i][j] = m[j][i]
+		}
+	}
+	return t
+}
+
+// Inverse uses Gauss-Jordan elimination with partial pivoting in float64. The second result is false when
+// the matrix is singular.
+func (m Mat4) Inverse() (Mat4, bool) {
+	var a [4][8]float64
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			a[i][j] = float64(m[i][j])
+		}
+		a[i][4+i] = 1
+	}
+
+	for col := 0; col < 4; col++ {
+		pivot := col
+		for row := col + 1; row < 4; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return Mat4{}, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+
+		inv := 1 / a[col][col]
+		for j := 0; j < 8; j++ {
+			a[col][j] *= inv
+		}
+		for row := 0; row < 4; row++ {
+			if row == col {
+				continue
+			}
+			f := a[row][col]
+			for j := 0; j < 8; j++ {
+				a[row][j] -= f * a[col][j]
+			}
+		}
+	}
+
+	var out Mat4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			out[i][j] = float32(a[i][4+j])
+		}
+	}
+	return out, true
+}
+
+// Det3 is the determinant of the upper left 3x3 part, the factor the matrix scales volumes by
+func (m Mat4) Det3() float32 {
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
+
+// MulPoint transforms a position, including translation
+func (m Mat4) MulPoint(p Vec3) Vec3 {
+	return NewVec3(
+		m[0][0]*p.X+m[0][1]*p.Y+m[0][2]*p.Z+m[0][3],
+		m[1][0]*p.X+m[1][1]*p.Y+m[1][2]*p.Z+m[1][3],
+		m[2][0]*p.X+m[2][1]*p.Y+m[2][2]*p.Z+m[2][3],
+	)
+}
+
+// MulDir transforms a direction, ignoring translation
+func (m Mat4) MulDir(v Vec3) Vec3 {
+	return NewVec3(
+		m[0][0]*v.X+m[0][1]*v.Y+m[0][2]*v.Z,
+		m[1][0]*v.X+m[1][1]*v.Y+m[1][2]*v.Z,
+		m[2][0]*v.X+m[2][1]*v.Y+m[2][2]*v.Z,
+	)
+}
+
+// MulAabb gives the box around the eight transformed corners of a
+func (m Mat4) MulAabb(a Aabb) Aabb {
+	min := NewVec3(float32(math.Inf(1)), float32(math.Inf(1)), float32(math.Inf(1)))
+	max := NewVec3(float32(math.Inf(-1)), float32(math.Inf(-1)), float32(math.Inf(-1)))
+	for _, x := range []float32{a.x.min, a.x.max} {
+		for _, y := range []float32{a.y.min, a.y.max} {
+			for _, z := range []float32{a.z.min, a.z.max} {
+				p := m.MulPoint(NewVec3(x, y, z))
+				min = NewVec3(MinF32(min.X, p.X), MinF32(min.Y, p.Y), MinF32(min.Z, p.Z))
+				max = NewVec3(MaxF32(max.X, p.X), MaxF32(max.Y, p.Y), MaxF32(max.Z, p.Z))
+			}
+		}
+	}
+	return NewAabb(min, max).GetPaddedAabb()
+}
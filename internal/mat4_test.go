@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMat4Inverse(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Mat4
+	}{
+		{"identity", NewMat4Identity()},
+		{"translate", NewMat4Translate(NewVec3(1, -2, 3))},
+		{"uneven scale", NewMat4Scale(NewVec3(2, 0.5, -3))},
+		{"rotate about a tilted axis", NewMat4Rotate(NewVec3(1, 2, 3), 37)},
+		{"scale, rotate and translate", TRS{
+			Scale:     NewVec3(2, 1, 3),
+			Rotate:    NewVec3(10, 30, -45),
+			Translate: NewVec3(1, 2, -1),
+		}.Mat4()},
+	}
+	for _, tt := range tests {
+		inv, ok := tt.m.Inverse()
+		if !ok {
+			t.Errorf("%s: found singular", tt.name)
+			continue
+		}
+		for _, product := range []Mat4{MulMat4(tt.m, inv), MulMat4(inv, tt.m)} {
+			identity := NewMat4Identity()
+			for i := range product {
+				for j := range product[i] {
+					if !approxEqual(product[i][j], identity[i][j], 1e-5) {
+						t.Fatalf("%s: matrix times its inverse is %v, want the identity", tt.name, product)
+					}
+				}
+			}
+		}
+	}
+
+	for _, s := range []Vec3{NewVec3(0, 1, 1), NewVec3(1, 1, 0)} {
+		if _, ok := NewMat4Scale(s).Inverse(); ok {
+			t.Errorf("scale by %v has an inverse, want it found singular", s)
+		}
+	}
+}
+
+func TestMat4MulAabb(t *testing.T) {
+	box := NewAabb(NewVec3(-1, -1, -1), NewVec3(1, 1, 1))
+	sqrt2 := float32(math.Sqrt2)
+
+	tests := []struct {
+		name     string
+		m        Mat4
+		min, max Vec3
+	}{
+		{"translate", NewMat4Translate(NewVec3(1, 2, 3)), NewVec3(0, 1, 2), NewVec3(2, 3, 4)},
+		{"uneven scale", NewMat4Scale(NewVec3(2, 0.5, -3)), NewVec3(-2, -0.5, -3), NewVec3(2, 0.5, 3)},
+		// The corners swing out to the diagonal of the square seen from above
+		{"rotate 45 about y", NewMat4Rotate(NewVec3(0, 1, 0), 45), NewVec3(-sqrt2, -1, -sqrt2), NewVec3(sqrt2, 1, sqrt2)},
+	}
+	for _, tt := range tests {
+		got := tt.m.MulAabb(box)
+		gotMin := NewVec3(got.x.min, got.y.min, got.z.min)
+		gotMax := NewVec3(got.x.max, got.y.max, got.z.max)
+		if !approxEqualVec3(gotMin, tt.min, 1e-5) || !approxEqualVec3(gotMax, tt.max, 1e-5) {
+			t.Errorf("%s: box from %v to %v, want %v to %v", tt.name, gotMin, gotMax, tt.min, tt.max)
+		}
+	}
+}
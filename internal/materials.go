@@ -9,14 +9,40 @@ import (
 type Material interface {
 	Scatter(r *Ray, hi HitInfo) (ScatterInfo, bool)
 	Emit(u, v float32, p Vec3) Color
+	// ScatteringPDF is the density of light arriving along r scattering towards dir. Evaluated for any dir, the
+	// BSDF times the cosine term is attenuation * ScatteringPDF. Specular materials return 0.
+	ScatteringPDF(r *Ray, hi HitInfo, dir Vec3) float32
 }
 
+// ScatterInfo describes how a material scatters. Materials that can be sampled set pdf, which the tracer
+// samples and combines with light sampling. Specular materials leave pdf nil and give the one ray they
+// scatter along instead.
 type ScatterInfo struct {
 	ray         Ray
 	attenuation Color
+	pdf         PDF
+}
+
+// Specular is true when the scattered direction is fixed by the material rather than drawn from pdf
+func (si ScatterInfo) Specular() bool {
+	return si.pdf == nil
+}
+
+// materialID identifies a material in the material ID pass. Materials embed it and World.NumberMaterials
+// numbers them from 1 in the order it first reaches them, so the IDs of a scene are the same from one run to
+// the next.
+type materialID uint32
+
+func (id materialID) ID() uint32 {
+	return uint32(id)
+}
+
+func (id *materialID) setID(v uint32) {
+	*id = materialID(v)
 }
 
 type Lambertian struct {
+	materialID
 	albedo Texture
 }
 
@@ -30,18 +56,27 @@ func NewLambertian(albedo Texture) Lambertian {
 	}
 }
 
+func (l *Lambertian) Albedo(hi HitInfo) Vec3 {
+	return l.albedo.GetTexture(hi.u, hi.v, hi.point).GetColor()
+}
+
 func (l *Lambertian) Scatter(r *Ray, hi HitInfo) (ScatterInfo, bool) {
-	dir := Add(hi.normal, NewVec3UnitRandOnUnitSphere32(r.rand))
-	if dir.NearZero() {
-		dir = hi.normal
-	}
 	return ScatterInfo{
-		ray:         *NewRay(hi.point, dir, r.rand),
 		attenuation: l.albedo.GetTexture(hi.u, hi.v, hi.point),
+		pdf:         NewCosinePDF(hi.normal),
 	}, true
 }
 
+func (l *Lambertian) ScatteringPDF(r *Ray, hi HitInfo, dir Vec3) float32 {
+	cosine := Dot(hi.normal, Unit(dir))
+	return MaxF32(0, cosine/PiF32)
+}
+
+// Metal reflects like a mirror. A fuzzy metal spreads the reflection evenly over a cone around the mirror
+// direction, whose half angle has sine fuzz, so the tracer can weigh it against light sampling. A fuzz of 1
+// or more widens the cone to the whole hemisphere around the mirror direction.
 type Metal struct {
+	materialID
 	albedo Color
 	fuzz   float32
 }
@@ -57,24 +92,50 @@ func NewMetal(albedo Vec3, fuzz float32) Metal {
 	}
 }
 
-func (m *Metal) Scatter(r *Ray, hi HitInfo) (ScatterInfo, bool) {
-	unitDir := Unit(r.dir)
-	reflected := reflect(unitDir, hi.normal)
+func (m *Metal) Albedo(hi HitInfo) Vec3 {
+	return m.albedo.GetColor()
+}
 
-	fuzz := NewVec3UnitRandOnUnitSphere32(r.rand)
-	fuzz.Scale(m.fuzz)
+func (m *Metal) Scatter(r *Ray, hi HitInfo) (ScatterInfo, bool) {
+	reflected := reflect(Unit(r.dir), hi.normal)
+	if lobe, ok := m.lobe(reflected); ok {
+		return ScatterInfo{
+			attenuation: m.albedo,
+			pdf:         lobe,
+		}, true
+	}
 
-	scattered := Add(reflected, fuzz)
-	if Dot(scattered, hi.normal) > 0 {
+	if Dot(reflected, hi.normal) > 0 {
 		return ScatterInfo{
-			ray:         *NewRay(hi.point, scattered, r.rand),
+			ray:         *NewRay(hi.point, reflected, r.time, r.sampler),
 			attenuation: m.albedo,
 		}, true
 	}
 	return ScatterInfo{}, false
 }
 
+// lobe is the cone fuzzy reflections around reflected are spread over, or false when the metal is too smooth
+// for the cone to be told apart from the mirror direction
+func (m *Metal) lobe(reflected Vec3) (ConePDF, bool) {
+	lobe := NewConePDF(reflected, min(m.fuzz, 1))
+	return lobe, lobe.cosThetaMax < 1
+}
+
+// ScatteringPDF is the density of the lobe, which is all that leaves the surface: the albedo is the only
+// other factor of the reflection
+func (m *Metal) ScatteringPDF(r *Ray, hi HitInfo, dir Vec3) float32 {
+	if Dot(dir, hi.normal) <= 0 {
+		return 0
+	}
+	lobe, ok := m.lobe(reflect(Unit(r.dir), hi.normal))
+	if !ok {
+		return 0
+	}
+	return lobe.Value(dir)
+}
+
 type Dielectric struct {
+	materialID
 	refractiveIndex float32
 }
 
@@ -88,6 +149,11 @@ func NewDielectric(refracitveIndex float32) Dielectric {
 	}
 }
 
+// Albedo of glass is white, it absorbs nothing
+func (d *Dielectric) Albedo(hi HitInfo) Vec3 {
+	return NewVec3(1, 1, 1)
+}
+
 func (d *Dielectric) Scatter(r *Ray, hi HitInfo) (ScatterInfo, bool) {
 	etaOEtaPrime := d.refractiveIndex
 	if hi.frontFace {
@@ -100,24 +166,59 @@ func (d *Dielectric) Scatter(r *Ray, hi HitInfo) (ScatterInfo, bool) {
 	sinTheta := float32(math.Sqrt(1 - float64(cosTheta*cosTheta)))
 	cannotRefract := sinTheta*etaOEtaPrime > 1.0
 	var direction Vec3
-	if cannotRefract || reflectance(cosTheta, etaOEtaPrime) > rand.Float32() {
+	if cannotRefract || reflectance(cosTheta, etaOEtaPrime) > r.sampler.Get1D() {
 		direction = reflect(unitDir, hi.normal)
 	} else {
 		direction = refract(unitDir, hi.normal, etaOEtaPrime)
 	}
 
 	return ScatterInfo{
-		ray:         *NewRay(hi.point, direction, r.rand),
+		ray:         *NewRay(hi.point, direction, r.time, r.sampler),
 		attenuation: NewVec3(1, 1, 1),
 	}, true
 }
 
+func (d *Dielectric) ScatteringPDF(r *Ray, hi HitInfo, dir Vec3) float32 {
+	return 0
+}
+
 func reflectance(cosTheta, etaOEtaPrime float32) float32 {
 	r0 := (1.0 - etaOEtaPrime) / (1.0 + etaOEtaPrime)
 	r0 *= r0
 	return r0 + (1-r0)*float32(math.Pow(1-float64(cosTheta), 5))
 }
 
+// Isotropic scatters light equally in every direction. It is the phase function of a ConstantMedium.
+type Isotropic struct {
+	materialID
+	albedo Texture
+}
+
+func (i Isotropic) Emit(u float32, v float32, p Vec3) Color {
+	return NewVec3Zero()
+}
+
+func NewIsotropic(albedo Texture) Isotropic {
+	return Isotropic{
+		albedo: albedo,
+	}
+}
+
+func (i *Isotropic) Albedo(hi HitInfo) Vec3 {
+	return i.albedo.GetTexture(hi.u, hi.v, hi.point).GetColor()
+}
+
+func (i *Isotropic) Scatter(r *Ray, hi HitInfo) (ScatterInfo, bool) {
+	return ScatterInfo{
+		attenuation: i.albedo.GetTexture(hi.u, hi.v, hi.point),
+		pdf:         NewSpherePDF(),
+	}, true
+}
+
+func (i *Isotropic) ScatteringPDF(r *Ray, hi HitInfo, dir Vec3) float32 {
+	return 1 / (4 * PiF32)
+}
+
 type Checkered struct {
 	scale float32
 	even  Color
@@ -208,9 +309,9 @@ func NewPerlin(randCtx *rand.Rand) Perlin {
 
 	return Perlin{
 		randVec3: points,
-		permX:    Permute(GetNums(pointCount)),
-		permY:    Permute(GetNums(pointCount)),
-		permZ:    Permute(GetNums(pointCount)),
+		permX:    Permute(randCtx, GetNums(pointCount)),
+		permY:    Permute(randCtx, GetNums(pointCount)),
+		permZ:    Permute(randCtx, GetNums(pointCount)),
 	}
 
 }
@@ -269,9 +370,9 @@ func GetNums(closedUpperEnd int) []int {
 	return n
 }
 
-func Permute(p []int) []int {
+func Permute(randCtx *rand.Rand, p []int) []int {
 	for i := len(p) - 1; i > 0; i-- {
-		target := rand.Intn(i)
+		target := randCtx.Intn(i)
 		p[i], p[target] = p[target], p[i]
 	}
 	return p
@@ -295,6 +396,7 @@ func NewNoiseTexture(randCtx *rand.Rand, scale float32) NoiseTexture {
 }
 
 type DiffuseLight struct {
+	materialID
 	emit Texture
 }
 
@@ -302,12 +404,22 @@ func (d DiffuseLight) Scatter(r *Ray, hi HitInfo) (ScatterInfo, bool) {
 	return ScatterInfo{}, false
 }
 
+func (d DiffuseLight) ScatteringPDF(r *Ray, hi HitInfo, dir Vec3) float32 {
+	return 0
+}
+
 func NewDiffuseLight(emit Texture) DiffuseLight {
 	return DiffuseLight{
 		emit: emit,
 	}
 }
 
+// Albedo of a light is its emission clamped to the displayable range
+func (d DiffuseLight) Albedo(hi HitInfo) Vec3 {
+	col := d.emit.GetTexture(hi.u, hi.v, hi.point).GetColor()
+	return NewVec3(Clamp(0, 1, col.X), Clamp(0, 1, col.Y), Clamp(0, 1, col.Z))
+}
+
 func (d DiffuseLight) Emit(u float32, v float32, p Vec3) Color {
 	return d.emit.GetTexture(u, v, p)
 }
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"math"
+)
+
+// ConstantMedium fills a closed boundary with a participating medium of uniform density, such as fog or smoke.
+// Rays scatter at exponentially distributed distances inside the boundary according to the phase material,
+// usually Isotropic.
+type ConstantMedium struct {
+	boundary      Hittable
+	negInvDensity float32
+	phase         Material
+}
+
+func NewConstantMedium(boundary Hittable, density float32, phase Material) *ConstantMedium {
+	return &ConstantMedium{
+		boundary:      boundary,
+		negInvDensity: -1 / density,
+		phase:         phase,
+	}
+}
+
+func (m *ConstantMedium) Hit(r *Ray, rayT Interval) (HitInfo, bool) {
+	enter, ok := m.boundary.Hit(r, Interval{
+		min: float32(math.Inf(-1)),
+		max: float32(math.Inf(1)),
+	})
+	if !ok {
+		return HitInfo{}, false
+	}
+
+	exit, ok := m.boundary.Hit(r, Interval{
+		min: enter.t + 0.0001,
+		max: float32(math.Inf(1)),
+	})
+	if !ok {
+		return HitInfo{}, false
+	}
+
+	t0 := MaxF32(enter.t, MaxF32(rayT.min, 0))
+	t1 := MinF32(exit.t, rayT.max)
+	if t0 >= t1 {
+		return HitInfo{}, false
+	}
+
+	rayLen := r.dir.Len()
+	distanceInside := (t1 - t0) * rayLen
+	// Hit is called for every ray that reaches the bounds, shadow rays included, so the distance is drawn from
+	// the independent stream instead of taking a dimension meant for the bounce
+	hitDistance := m.negInvDensity * float32(math.Log(float64(1-r.sampler.Independent1D())))
+	if hitDistance > distanceInside {
+		return HitInfo{}, false
+	}
+
+	t := t0 + hitDistance/rayLen
+	// The normal and face are meaningless inside a medium, the phase material ignores them
+	return HitInfo{
+		point:     r.At(t),
+		normal:    NewVec3(1, 0, 0),
+		t:         t,
+		material:  m.phase,
+		frontFace: true,
+	}, true
+}
+
+func (m *ConstantMedium) GetBounds() Aabb {
+	return m.boundary.GetBounds()
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+// TestConstantMediumTransmittance sends rays through a sphere of fog. The fraction that cross it without
+// scattering should follow the Beer-Lambert law, exp(-density * distance inside).
+func TestConstantMediumTransmittance(t *testing.T) {
+	const density = 0.5
+	white := NewLambertian(NewSolidColor(1, 1, 1))
+	smoke := NewIsotropic(NewSolidColor(1, 1, 1))
+	medium := NewConstantMedium(NewSphere(NewVec3Zero(), 1, &white), density, &smoke)
+
+	tests := []struct {
+		name     string
+		ray      *Ray
+		distance float64
+	}{
+		{"through the centre", NewRay(NewVec3(0, 0, -5), NewVec3(0, 0, 1), 0, nil), 2},
+		// t is measured along the direction, the distance inside must not depend on its length
+		{"long direction", NewRay(NewVec3(0, 0, -5), NewVec3(0, 0, 3), 0, nil), 2},
+		{"off centre", NewRay(NewVec3(0.6, 0, -5), NewVec3(0, 0, 1), 0, nil), 1.6},
+		{"from inside", NewRay(NewVec3Zero(), NewVec3(0, 0, 1), 0, nil), 1},
+	}
+
+	const n = 20000
+	for _, tt := range tests {
+		s := newSampler(SamplerIndependent, 1, 1)
+		tt.ray.sampler = s
+		passed := 0
+		for k := 0; k < n; k++ {
+			s.StartPixelSample(0, 0, k)
+			hi, ok := medium.Hit(tt.ray, Interval{min: 0, max: float32(math.Inf(1))})
+			if !ok {
+				passed++
+				continue
+			}
+			if p := hi.point; p.LenSq() > 1+1e-4 {
+				t.Fatalf("%s: scattered at %v, outside the fog", tt.name, hi.point)
+			}
+		}
+		want := math.Exp(-density * tt.distance)
+		if got := float64(passed) / n; math.Abs(got-want) > 0.015 {
+			t.Errorf("%s: %.3f of the rays crossed, want %.3f", tt.name, got, want)
+		}
+	}
+}
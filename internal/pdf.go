@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"math"
+)
+
+// PDF is a distribution of directions that can be sampled and evaluated
+type PDF interface {
+	// Value is the solid angle density of generating dir
+	Value(dir Vec3) float32
+	Generate(s Sampler) Vec3
+}
+
+// ONB is an orthonormal basis whose w axis points along a given direction
+type ONB struct {
+	u Vec3
+	v Vec3
+	w Vec3
+}
+
+func NewONB(n Vec3) ONB {
+	w := Unit(n)
+	a := NewVec3(1, 0, 0)
+	if AbsF32(w.X) > 0.9 {
+		a = NewVec3(0, 1, 0)
+	}
+	v := Unit(Cross(w, a))
+	u := Cross(w, v)
+
+	return ONB{u: u, v: v, w: w}
+}
+
+// Local converts coordinates in the basis into world space
+func (o ONB) Local(a Vec3) Vec3 {
+	return Add(Add(Scale(o.u, a.X), Scale(o.v, a.Y)), Scale(o.w, a.Z))
+}
+
+// CosinePDF favours directions close to a normal in proportion to their cosine
+type CosinePDF struct {
+	uvw ONB
+}
+
+func NewCosinePDF(normal Vec3) CosinePDF {
+	return CosinePDF{
+		uvw: NewONB(normal),
+	}
+}
+
+func (c CosinePDF) Value(dir Vec3) float32 {
+	cosine := Dot(Unit(dir), c.uvw.w)
+	return MaxF32(0, cosine/PiF32)
+}
+
+func (c CosinePDF) Generate(s Sampler) Vec3 {
+	return c.uvw.Local(randomCosineDirection(s))
+}
+
+func randomCosineDirection(s Sampler) Vec3 {
+	r1, r2 := s.Get2D()
+
+	phi := 2 * PiF32 * r1
+	x := float32(math.Cos(float64(phi)) * math.Sqrt(float64(r2)))
+	y := float32(math.Sin(float64(phi)) * math.Sqrt(float64(r2)))
+	z := float32(math.Sqrt(float64(1 - r2)))
+
+	return NewVec3(x, y, z)
+}
+
+// randomInCone is uniform over the directions within the cone around +z whose angle has cosine cosThetaMax
+func randomInCone(cosThetaMax float32, s Sampler) Vec3 {
+	r1, r2 := s.Get2D()
+	z := 1 + r2*(cosThetaMax-1)
+	phi := 2 * PiF32 * r1
+	sinTheta := float32(math.Sqrt(float64(1 - z*z)))
+	x := float32(math.Cos(float64(phi))) * sinTheta
+	y := float32(math.Sin(float64(phi))) * sinTheta
+
+	return NewVec3(x, y, z)
+}
+
+// ConePDF is uniform over the directions within a cone around an axis. It is the glossy lobe of a fuzzy Metal.
+type ConePDF struct {
+	uvw         ONB
+	cosThetaMax float32
+	// solidAngle is kept apart from cosThetaMax, whose distance from 1 float32 cannot hold for narrow cones
+	solidAngle float32
+}
+
+// NewConePDF is the cone around axis whose half angle has sine sinThetaMax
+func NewConePDF(axis Vec3, sinThetaMax float32) ConePDF {
+	sin2 := sinThetaMax * sinThetaMax
+	cosThetaMax := float32(math.Sqrt(float64(1 - sin2)))
+	return ConePDF{
+		uvw:         NewONB(axis),
+		cosThetaMax: cosThetaMax,
+		solidAngle:  2 * PiF32 * sin2 / (1 + cosThetaMax),
+	}
+}
+
+func (c ConePDF) Value(dir Vec3) float32 {
+	if Dot(Unit(dir), c.uvw.w) < c.cosThetaMax {
+		return 0
+	}
+	return 1 / c.solidAngle
+}
+
+func (c ConePDF) Generate(s Sampler) Vec3 {
+	return c.uvw.Local(randomInCone(c.cosThetaMax, s))
+}
+
+// SpherePDF is uniform over every direction
+type SpherePDF struct{}
+
+func NewSpherePDF() SpherePDF {
+	return SpherePDF{}
+}
+
+func (s SpherePDF) Value(dir Vec3) float32 {
+	return 1 / (4 * PiF32)
+}
+
+func (s SpherePDF) Generate(sampler Sampler) Vec3 {
+	return sampleUniformSphere(sampler.Get2D())
+}
+
+// sampleUniformSphere maps a point of the unit square to a uniformly distributed unit vector
+func sampleUniformSphere(u, v float32) Vec3 {
+	z := 1 - 2*u
+	r := float32(math.Sqrt(float64(MaxF32(0, 1-z*z))))
+	phi := 2 * PiF32 * v
+	return NewVec3(r*float32(math.Cos(float64(phi))), r*float32(math.Sin(float64(phi))), z)
+}
+
+// sampleUnitDisk maps a point of the unit square to a uniformly distributed point of the unit disc with
+// Shirley and Chiu's concentric mapping, which keeps stratified points stratified
+func sampleUnitDisk(u, v float32) Vec3 {
+	a := 2*u - 1
+	b := 2*v - 1
+	if a == 0 && b == 0 {
+		return NewVec3Zero()
+	}
+	var r, theta float32
+	if AbsF32(a) > AbsF32(b) {
+		r = a
+		theta = PiF32 / 4 * (b / a)
+	} else {
+		r = b
+		theta = PiF32/2 - PiF32/4*(a/b)
+	}
+	return NewVec3(r*float32(math.Cos(float64(theta))), r*float32(math.Sin(float64(theta))), 0)
+}
+
+// HittablePDF aims from origin towards an Emitter, such as a light or a LightList
+type HittablePDF struct {
+	emitter Emitter
+	origin  Vec3
+}
+
+func NewHittablePDF(emitter Emitter, origin Vec3) HittablePDF {
+	return HittablePDF{
+		emitter: emitter,
+		origin:  origin,
+	}
+}
+
+func (h HittablePDF) Value(dir Vec3) float32 {
+	return h.emitter.PDFValue(h.origin, dir)
+}
+
+func (h HittablePDF) Generate(s Sampler) Vec3 {
+	return h.emitter.Random(h.origin, s)
+}
+
+// MixturePDF samples its first PDF with probability weight and its second otherwise
+type MixturePDF struct {
+	p      [2]PDF
+	weight float32
+}
+
+func NewMixturePDF(p0, p1 PDF, weight float32) MixturePDF {
+	return MixturePDF{
+		p:      [2]PDF{p0, p1},
+		weight: weight,
+	}
+}
+
+func (m MixturePDF) Value(dir Vec3) float32 {
+	return m.weight*m.p[0].Value(dir) + (1-m.weight)*m.p[1].Value(dir)
+}
+
+func (m MixturePDF) Generate(s Sampler) Vec3 {
+	if s.Get1D() < m.weight {
+		return m.p[0].Generate(s)
+	}
+	return m.p[1].Generate(s)
+}
+
+// MISHeuristic decides how much a sample from one strategy counts when another strategy could have produced
+// it too
+type MISHeuristic int
+
+const (
+	BalanceHeuristic MISHeuristic = iota
+	PowerHeuristic
+)
+
+// Weight of a sample taken with density pdf when the other strategy has density otherPDF for it
+func (h MISHeuristic) Weight(pdf, otherPDF float32) float32 {
+	if h == PowerHeuristic {
+		pdf *= pdf
+		otherPDF *= otherPDF
+	}
+	if pdf+otherPDF <= 0 {
+		return 0
+	}
+	return pdf / (pdf + otherPDF)
+}
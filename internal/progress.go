@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// Progress is a snapshot of how far along a render is
+type Progress struct {
+	TilesDone     int
+	TilesTotal    int
+	PixelsDone    int
+	PixelsTotal   int
+	SamplesTraced int64
+	Elapsed       time.Duration
+	ETA           time.Duration
+}
+
+// Fraction is the portion of pixels finished, from 0 to 1
+func (p Progress) Fraction() float64 {
+	if p.PixelsTotal == 0 {
+		return 1
+	}
+	return float64(p.PixelsDone) / float64(p.PixelsTotal)
+}
+
+// SamplesPerPixel is the average number of samples traced for the finished pixels, which is lower than the
+// camera's samples per pixel when adaptive sampling stops pixels early
+func (p Progress) SamplesPerPixel() float64 {
+	if p.PixelsDone == 0 {
+		return 0
+	}
+	return float64(p.SamplesTraced) / float64(p.PixelsDone)
+}
+
+// ProgressFunc receives a Progress every time a tile finishes. Calls are never concurrent.
+type ProgressFunc func(Progress)
+
+// ProgressToChan forwards progress to ch, dropping updates when ch is full so a slow consumer never stalls a render
+func ProgressToChan(ch chan<- Progress) ProgressFunc {
+	return func(p Progress) {
+		select {
+		case ch <- p:
+		default:
+		}
+	}
+}
+
+type progressTracker struct {
+	mu       sync.Mutex
+	fn       ProgressFunc
+	start    time.Time
+	progress Progress
+}
+
+func newProgressTracker(fn ProgressFunc, tilesTotal, pixelsTotal int) *progressTracker {
+	return &progressTracker{
+		fn:    fn,
+		start: time.Now(),
+		progress: Progress{
+			TilesTotal:  tilesTotal,
+			PixelsTotal: pixelsTotal,
+		},
+	}
+}
+
+func (pt *progressTracker) tileDone(pixels int, samples int64) {
+	if pt.fn == nil {
+		return
+	}
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	p := &pt.progress
+	p.TilesDone++
+	p.PixelsDone += pixels
+	p.SamplesTraced += samples
+	p.Elapsed = time.Since(pt.start)
+	p.ETA = 0
+	if p.PixelsDone > 0 {
+		remaining := p.PixelsTotal - p.PixelsDone
+		p.ETA = time.Duration(float64(p.Elapsed) * float64(remaining) / float64(p.PixelsDone))
+	}
+
+	pt.fn(*p)
+}
@@ -0,0 +1,64 @@
+package internal
+
+import "testing"
+
+// TestProgress renders with several workers and small tiles and checks every update the callback receives,
+// with every pixel taking all its samples and with adaptive sampling stopping some of them early
+func TestProgress(t *testing.T) {
+	const width, spp = 24, 16
+	world := NewBVHFromWorld(determinismTestScene())
+
+	tests := []struct {
+		name     string
+		opts     []CameraOpt
+		min, max float64
+	}{
+		{"fixed", nil, spp, spp},
+		{"adaptive", []CameraOpt{WithAdaptiveSampling(4, 0.2)}, 4, spp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updates []Progress
+			camera := NewCamera(1, width, append([]CameraOpt{
+				WithSamplesPerPixel(spp),
+				WithMaxRayDepth(4),
+				WithLookFrom(NewVec3(0, 2, 6)),
+				WithLookAt(NewVec3(0, 1, 0)),
+				WithWorkers(3),
+				WithTileSize(5),
+				WithProgress(func(p Progress) {
+					updates = append(updates, p)
+				}),
+			}, tt.opts...)...)
+			camera.RenderFramebuffer(world)
+
+			if len(updates) == 0 {
+				t.Fatal("progress was never reported")
+			}
+			last := updates[len(updates)-1]
+			if len(updates) != last.TilesTotal || last.TilesDone != last.TilesTotal {
+				t.Errorf("%d updates, the last at %d of %d tiles, want one for every tile", len(updates),
+					last.TilesDone, last.TilesTotal)
+			}
+			if last.PixelsTotal != width*width {
+				t.Errorf("%d pixels in total, want %d", last.PixelsTotal, width*width)
+			}
+			for k := 1; k < len(updates); k++ {
+				prev, p := updates[k-1], updates[k]
+				if p.TilesDone != prev.TilesDone+1 || p.Fraction() <= prev.Fraction() ||
+					p.SamplesTraced <= prev.SamplesTraced {
+					t.Fatalf("update %d went from %+v to %+v, want every tile to add to the progress", k, prev, p)
+				}
+			}
+			if last.Fraction() != 1 || last.ETA != 0 {
+				t.Errorf("finished at fraction %v with an ETA of %v, want 1 and 0", last.Fraction(), last.ETA)
+			}
+			if got := last.SamplesPerPixel(); got < tt.min || got > tt.max {
+				t.Errorf("%v samples per pixel, want between %v and %v", got, tt.min, tt.max)
+			}
+			if tt.min < tt.max && last.SamplesPerPixel() == tt.max {
+				t.Errorf("adaptive sampling took all %v samples of every pixel", tt.max)
+			}
+		})
+	}
+}
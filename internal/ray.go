@@ -2,26 +2,31 @@ package internal
 
 import (
 	"math"
-	"math/rand"
-	"time"
 )
 
 type Ray struct {
-	origin    Vec3
-	dir       Vec3
-	rand      *rand.Rand
-	startTime time.Time
+	origin Vec3
+	dir    Vec3
+	// sampler gives the random numbers of everything that happens along the ray and after it bounces
+	sampler Sampler
+	// time is when the ray was cast within the camera's shutter interval, moving objects are hit where they
+	// were at that time
+	time float32
 }
 
-func NewRay(origin, dir Vec3, randCtx *rand.Rand) *Ray {
+func NewRay(origin, dir Vec3, time float32, sampler Sampler) *Ray {
 	return &Ray{
-		origin:    origin,
-		dir:       dir,
-		rand:      randCtx,
-		startTime: time.Now(),
+		origin:  origin,
+		dir:     dir,
+		sampler: sampler,
+		time:    time,
 	}
 }
 
+func (r *Ray) Time() float32 {
+	return r.time
+}
+
 func (r *Ray) At(t float32) Vec3 {
 	dir := r.dir.Cpy()
 	dir.Scale(t)
@@ -29,28 +34,164 @@ func (r *Ray) At(t float32) Vec3 {
 	return dir
 }
 
-func (r *Ray) GetColor(world Hittable, backgroundColor Color, maxDepth int) Color {
-	if maxDepth <= 0 {
+// Tracer finds the color seen along rays in a world. When the world has lights, every non specular hit
+// samples both the lights and the material, and the two estimates are combined with multiple importance
+// sampling.
+type Tracer struct {
+	world  Hittable
+	lights *LightList
+	// environment is the background when it is an Emitter, nil otherwise
+	environment Emitter
+	background  Environment
+	maxDepth    int
+	heuristic   MISHeuristic
+}
+
+// NewTracer samples the lights of the world along with the background, when the background is an Emitter
+// such as an EnvironmentMap
+func NewTracer(world Hittable, background Environment, maxDepth int, heuristic MISHeuristic) *Tracer {
+	environment, _ := background.(Emitter)
+	return &Tracer{
+		world:       world,
+		lights:      LightsOf(world),
+		environment: environment,
+		background:  background,
+		maxDepth:    maxDepth,
+		heuristic:   heuristic,
+	}
+}
+
+// hasLights reports whether there is anything for light sampling to aim at
+func (t *Tracer) hasLights() bool {
+	return t.lights.Len() > 0 || t.environment != nil
+}
+
+// lightPDF aims from origin towards the lights. When there is both an environment and lights in the world,
+// each gets half the samples, so a mesh with thousands of emissive faces cannot starve the sky.
+func (t *Tracer) lightPDF(origin Vec3) PDF {
+	switch {
+	case t.environment == nil:
+		return NewHittablePDF(t.lights, origin)
+	case t.lights.Len() == 0:
+		return NewHittablePDF(t.environment, origin)
+	}
+	return NewMixturePDF(NewHittablePDF(t.lights, origin), NewHittablePDF(t.environment, origin), 0.5)
+}
+
+func (t *Tracer) GetColor(r *Ray) Color {
+	return t.getColor(r, t.maxDepth, 0)
+}
+
+// GetColorAndHit is GetColor that also returns what the ray hit first, if anything
+func (t *Tracer) GetColorAndHit(r *Ray) (Vec3, HitInfo, bool) {
+	if t.maxDepth <= 0 {
+		return NewVec3Zero(), HitInfo{}, false
+	}
+
+	r.sampler.StartDimension(bounceDimension(0))
+	hitInfo, ok := t.world.Hit(r, Interval{
+		min: 0.001,
+		max: float32(math.Inf(1)),
+	})
+	if !ok {
+		return t.background.Radiance(r.dir), HitInfo{}, false
+	}
+	return t.shade(r, hitInfo, t.maxDepth, 0), hitInfo, true
+}
+
+// getColor follows r through the world. bsdfPDF is the density the previous hit's material sampled r with,
+// or 0 when r is a camera ray or a specular bounce and light sampling could not have found the same light.
+func (t *Tracer) getColor(r *Ray, depth int, bsdfPDF float32) Vec3 {
+	if depth <= 0 {
 		return NewVec3Zero()
 	}
 
-	if hitInfo, ok := world.Hit(r, Interval{
+	r.sampler.StartDimension(bounceDimension(t.maxDepth - depth))
+	hitInfo, ok := t.world.Hit(r, Interval{
 		min: 0.001,
 		max: float32(math.Inf(1)),
-	}); ok {
-		colorFromEmission := hitInfo.material.Emit(hitInfo.u, hitInfo.v, hitInfo.point).GetColor()
-		scatterInfo, didScatter := hitInfo.material.Scatter(r, hitInfo)
+	})
+	if !ok {
+		return Scale(t.background.Radiance(r.dir), t.emissionWeight(r, bsdfPDF))
+	}
+	return t.shade(r, hitInfo, depth, bsdfPDF)
+}
 
-		if !didScatter {
-			return colorFromEmission
-		}
+// shade is the light leaving a hit back along r
+func (t *Tracer) shade(r *Ray, hitInfo HitInfo, depth int, bsdfPDF float32) Vec3 {
+	colorFromEmission := hitInfo.material.Emit(hitInfo.u, hitInfo.v, hitInfo.point).GetColor()
+	if !colorFromEmission.NearZero() {
+		colorFromEmission.Scale(t.emissionWeight(r, bsdfPDF))
+	}
 
-		colorFromScatter := Mul(scatterInfo.attenuation.GetColor(), scatterInfo.ray.GetColor(world, backgroundColor, maxDepth-1).GetColor())
+	scatterInfo, didScatter := hitInfo.material.Scatter(r, hitInfo)
+	if !didScatter {
+		return colorFromEmission
+	}
 
+	attenuation := scatterInfo.attenuation.GetColor()
+	if scatterInfo.Specular() {
+		colorFromScatter := Mul(attenuation, t.getColor(&scatterInfo.ray, depth-1, 0))
 		return Add(colorFromEmission, colorFromScatter)
 	}
 
-	return backgroundColor
+	color := colorFromEmission
+	if t.hasLights() {
+		color.Add(t.sampleLight(r, hitInfo, scatterInfo))
+	}
+
+	dir := scatterInfo.pdf.Generate(r.sampler)
+	pdf := scatterInfo.pdf.Value(dir)
+	if pdf <= 0 {
+		return color
+	}
+	scattered := NewRay(hitInfo.point, dir, r.time, r.sampler)
+	weight := hitInfo.material.ScatteringPDF(r, hitInfo, dir) / pdf
+	color.Add(Scale(Mul(attenuation, t.getColor(scattered, depth-1, pdf)), weight))
+
+	return color
+}
+
+// emissionWeight is the MIS weight of light found by following a material sample
+func (t *Tracer) emissionWeight(r *Ray, bsdfPDF float32) float32 {
+	if bsdfPDF <= 0 || !t.hasLights() {
+		return 1
+	}
+	return t.heuristic.Weight(bsdfPDF, t.lightPDF(r.origin).Value(r.dir))
+}
+
+// sampleLight estimates the light arriving at a hit straight from a sampled light with one shadow ray,
+// weighted against the chance of the material sampling the same direction
+func (t *Tracer) sampleLight(r *Ray, hi HitInfo, si ScatterInfo) Vec3 {
+	lights := t.lightPDF(hi.point)
+	dir := lights.Generate(r.sampler)
+	lightPDF := lights.Value(dir)
+	if lightPDF <= 0 {
+		return NewVec3Zero()
+	}
+
+	scatteringPDF := hi.material.ScatteringPDF(r, hi, dir)
+	if scatteringPDF <= 0 {
+		return NewVec3Zero()
+	}
+
+	shadowRay := NewRay(hi.point, dir, r.time, r.sampler)
+	var emitted Vec3
+	if lightHit, ok := t.world.Hit(shadowRay, Interval{
+		min: 0.001,
+		max: float32(math.Inf(1)),
+	}); ok {
+		emitted = lightHit.material.Emit(lightHit.u, lightHit.v, lightHit.point).GetColor()
+	} else {
+		emitted = t.background.Radiance(dir)
+	}
+	if emitted.NearZero() {
+		return NewVec3Zero()
+	}
+
+	weight := t.heuristic.Weight(lightPDF, si.pdf.Value(dir))
+	bsdf := Scale(si.attenuation.GetColor(), scatteringPDF)
+	return Scale(Mul(bsdf, emitted), weight/lightPDF)
 }
 
 type Color interface {
@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+// TestMISConvergesFasterOnFuzzyMetal looks at the blurry reflection of a small light in a fuzzy metal floor.
+// Found only by following the glossy lobe the light is hit by few of the reflected rays, while sampling it as
+// well and weighing the two should give the same brightness with far less noise.
+func TestMISConvergesFasterOnFuzzyMetal(t *testing.T) {
+	light := NewDiffuseLight(NewSolidColor(50, 50, 50))
+	metal := NewMetal(NewVec3(0.9, 0.9, 0.9), 0.3)
+
+	world := NewWorld()
+	world.Add(NewQuad(NewVec3(-0.15, 2, -0.15), NewVec3(0.3, 0, 0), NewVec3(0, 0, 0.3), &light))
+	world.Add(NewQuad(NewVec3(-5, 0, -5), NewVec3(0, 0, 10), NewVec3(10, 0, 0), &metal))
+
+	withMIS := NewTracer(world, NewConstantEnvironment(NewVec3Zero()), 2, PowerHeuristic)
+	withoutMIS := NewTracer(world, NewConstantEnvironment(NewVec3Zero()), 2, PowerHeuristic)
+	withoutMIS.lights = NewLightList()
+
+	// From the eye at (0, 1, 2) towards where the centre of the light is mirrored in the floor
+	origin := NewVec3(0, 1, 2)
+	dir := Sub(NewVec3(0, 0, 4.0/3), origin)
+
+	const n = 20000
+	estimate := func(tracer *Tracer) (mean, variance float64) {
+		s := newSampler(SamplerIndependent, 1, 1)
+		var sum, sumSq float64
+		for k := 0; k < n; k++ {
+			s.StartPixelSample(0, 0, k)
+			c := tracer.GetColor(NewRay(origin, dir, 0, s)).GetColor()
+			sum += float64(c.X)
+			sumSq += float64(c.X) * float64(c.X)
+		}
+		mean = sum / n
+		return mean, sumSq/n - mean*mean
+	}
+
+	mean, variance := estimate(withMIS)
+	meanBSDF, varianceBSDF := estimate(withoutMIS)
+	if mean <= 0 {
+		t.Fatal("the reflection of the light is black")
+	}
+	stdErr := math.Sqrt((variance + varianceBSDF) / n)
+	if math.Abs(mean-meanBSDF) > 4*stdErr {
+		t.Errorf("brightness %v with MIS and %v without, want the same", mean, meanBSDF)
+	}
+	if variance*4 > varianceBSDF {
+		t.Errorf("variance %v with MIS and %v without, want MIS to be much less noisy", variance, varianceBSDF)
+	}
+}
@@ -0,0 +1,403 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+// Sampler hands out the numbers in [0, 1) that a sample of a pixel is made of, one dimension at a time. The
+// camera ray takes the first cameraDimensions and every bounce takes bounceDimensions after that, so the
+// same decision of every sample of a pixel uses the same dimension. Stratified and quasi-Monte Carlo samplers
+// spread the samples of a pixel evenly over each dimension, which gives less noise than independent random
+// numbers for the same number of samples.
+//
+// Every CameraWorker owns a Sampler, they are not safe for concurrent use.
+type Sampler interface {
+	// StartPixelSample begins the index-th sample of pixel (i, j) at dimension 0
+	StartPixelSample(i, j, index int)
+	// StartDimension skips ahead to dimension dim. It never goes back, so a sample that used more dimensions
+	// than it was given continues after them instead of reusing them.
+	StartDimension(dim int)
+	// Get1D is the next dimension
+	Get1D() float32
+	// Get2D is the next two dimensions, which stratified samplers spread evenly over the square together
+	Get2D() (float32, float32)
+	// Independent1D is a random number from a stream of its own that leaves the dimensions where they are. It
+	// is for code that runs a varying number of times per sample, such as Hittable.Hit during traversal.
+	Independent1D() float32
+}
+
+const (
+	// cameraDimensions are the position in the pixel, the position on the lens and the time of a camera ray
+	cameraDimensions = 5
+	// bounceDimensions are reserved for every bounce: picking a light, aiming at it and sampling the material.
+	// Crossing a medium happens inside Hit and draws from Independent1D instead.
+	bounceDimensions = 10
+)
+
+// bounceDimension is the first dimension of a bounce, 0 being the hit of the camera ray
+func bounceDimension(bounce int) int {
+	return cameraDimensions + bounce*bounceDimensions
+}
+
+// SamplerKind picks the Sampler every CameraWorker is given
+type SamplerKind int
+
+const (
+	// SamplerIndependent uses independent uniform random numbers for every dimension
+	SamplerIndependent SamplerKind = iota
+	// SamplerStratified jitters the samples of a pixel within strata of every dimension, or every pair of
+	// dimensions for 2D samples
+	SamplerStratified
+	// SamplerHalton uses the scrambled Halton sequence, shifted by a random Cranley-Patterson rotation per pixel
+	SamplerHalton
+	// SamplerSobol uses Owen scrambled Sobol points, shuffled per dimension so dimensions are not correlated
+	SamplerSobol
+)
+
+var samplerNames = []string{
+	SamplerIndependent: "independent",
+	SamplerStratified:  "stratified",
+	SamplerHalton:      "halton",
+	SamplerSobol:       "sobol",
+}
+
+func (k SamplerKind) String() string {
+	if k < 0 || int(k) >= len(samplerNames) {
+		return fmt.Sprintf("SamplerKind(%d)", int(k))
+	}
+	return samplerNames[k]
+}
+
+// ParseSampler finds the SamplerKind with the given name, as returned by String
+func ParseSampler(name string) (SamplerKind, error) {
+	for k, n := range samplerNames {
+		if n == name {
+			return SamplerKind(k), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown sampler %q, want one of %s", name, strings.Join(samplerNames, ", "))
+}
+
+// newSampler creates a sampler for pixels of samplesPerPixel samples. seed scrambles the sequences and the
+// random numbers, which are hashed from the pixel, the sample index and the dimension so they do not depend on
+// which worker renders a pixel or in which tile.
+func newSampler(kind SamplerKind, samplesPerPixel int, seed int64) Sampler {
+	samplesPerPixel = max(samplesPerPixel, 1)
+	switch kind {
+	case SamplerStratified:
+		return newStratifiedSampler(samplesPerPixel, seed)
+	case SamplerHalton:
+		return &haltonSampler{seed: uint64(seed)}
+	case SamplerSobol:
+		return &sobolSampler{samplesPerPixel: samplesPerPixel, seed: uint64(seed)}
+	default:
+		return &independentSampler{seed: uint64(seed)}
+	}
+}
+
+// independentSampler gives every dimension of every sample its own random number
+type independentSampler struct {
+	pixelSample
+	seed uint64
+}
+
+func (s *independentSampler) StartPixelSample(i, j, index int) {
+	s.start(s.seed, i, j, index)
+}
+
+func (s *independentSampler) Get1D() float32 {
+	u := s.uniform()
+	s.dim++
+	return u
+}
+
+func (s *independentSampler) Get2D() (float32, float32) {
+	return s.Get1D(), s.Get1D()
+}
+
+// pixelSample is the position in the samples of a pixel shared by the sequence samplers
+type pixelSample struct {
+	pixelHash   uint64
+	index       int
+	dim         int
+	independent uint64
+}
+
+func (p *pixelSample) start(seed uint64, i, j, index int) {
+	p.pixelHash = mixBits(seed ^ mixBits(uint64(uint32(i))<<32|uint64(uint32(j))))
+	p.index = index
+	p.dim = 0
+	p.independent = 0
+}
+
+// uniform is a random number for the current dimension of the pixel sample, for jitter and for dimensions a
+// sequence does not cover. It leaves the dimension where it is.
+func (p *pixelSample) uniform() float32 {
+	h := mixBits(p.dimensionHash() ^ mixBits(uint64(p.index)+0xd1b54a32d192ed03))
+	return uint32ToFloat(uint32(h >> 32))
+}
+
+// Independent1D hashes the pixel, the sample index and a count of the numbers drawn so far, so it depends
+// only on the pixel sample and not on the dimensions
+func (p *pixelSample) Independent1D() float32 {
+	p.independent++
+	h := mixBits(p.pixelHash ^ mixBits(uint64(p.index)<<32|p.independent))
+	return uint32ToFloat(uint32(h >> 32))
+}
+
+func (p *pixelSample) StartDimension(dim int) {
+	p.dim = max(p.dim, dim)
+}
+
+// dimensionHash is a hash of the pixel and the current dimension, used to scramble and shuffle it
+func (p *pixelSample) dimensionHash() uint64 {
+	return mixBits(p.pixelHash + uint64(p.dim+1)*0x9e3779b97f4a7c15)
+}
+
+// stratifiedSampler splits every dimension into as many strata as there are samples per pixel and every 2D
+// sample into a grid of about as many cells. The samples of a pixel visit the strata in an order shuffled
+// per dimension and are jittered within them.
+type stratifiedSampler struct {
+	pixelSample
+	samplesPerPixel int
+	xStrata         int
+	yStrata         int
+	seed            uint64
+}
+
+func newStratifiedSampler(samplesPerPixel int, seed int64) *stratifiedSampler {
+	xStrata := max(int(math.Sqrt(float64(samplesPerPixel))), 1)
+	return &stratifiedSampler{
+		samplesPerPixel: samplesPerPixel,
+		xStrata:         xStrata,
+		yStrata:         (samplesPerPixel + xStrata - 1) / xStrata,
+		seed:            uint64(seed),
+	}
+}
+
+func (s *stratifiedSampler) StartPixelSample(i, j, index int) {
+	s.start(s.seed, i, j, index)
+}
+
+func (s *stratifiedSampler) Get1D() float32 {
+	jitter := s.uniform()
+	if s.index >= s.samplesPerPixel {
+		s.dim++
+		return jitter
+	}
+	stratum := permutationElement(uint32(s.index), uint32(s.samplesPerPixel), uint32(s.dimensionHash()))
+	s.dim++
+	return MinF32((float32(stratum)+jitter)/float32(s.samplesPerPixel), oneMinusEpsilon)
+}
+
+func (s *stratifiedSampler) Get2D() (float32, float32) {
+	if s.index >= s.samplesPerPixel {
+		return s.Get1D(), s.Get1D()
+	}
+	cells := s.xStrata * s.yStrata
+	cell := int(permutationElement(uint32(s.index), uint32(cells), uint32(s.dimensionHash())))
+	jitterX := s.uniform()
+	s.dim++
+	jitterY := s.uniform()
+	s.dim++
+	x := (float32(cell%s.xStrata) + jitterX) / float32(s.xStrata)
+	y := (float32(cell/s.xStrata) + jitterY) / float32(s.yStrata)
+	return MinF32(x, oneMinusEpsilon), MinF32(y, oneMinusEpsilon)
+}
+
+// haltonMaxDimensions is how many dimensions the Halton sampler takes from the sequence, enough for 100
+// bounces. Later dimensions are independent random numbers.
+const haltonMaxDimensions = 1024
+
+var haltonPrimes = firstPrimes(haltonMaxDimensions)
+
+// haltonSampler gives the index-th sample of every pixel the index-th point of the Halton sequence, whose
+// dimension d is the radical inverse of the index in the d-th prime. The digits are scrambled with a random
+// permutation per digit and dimension, which breaks up the lines the points of large bases lie on, and every
+// pixel shifts the points by its own random offset so neighbouring pixels are not correlated.
+type haltonSampler struct {
+	pixelSample
+	seed uint64
+}
+
+func (s *haltonSampler) StartPixelSample(i, j, index int) {
+	s.start(s.seed, i, j, index)
+}
+
+func (s *haltonSampler) Get1D() float32 {
+	if s.dim >= haltonMaxDimensions {
+		u := s.uniform()
+		s.dim++
+		return u
+	}
+	offset := float64(s.dimensionHash()>>11) * 0x1p-53
+	x := scrambledRadicalInverse(s.dim, uint64(s.index), s.seed) + offset
+	s.dim++
+	return MinF32(float32(x-math.Floor(x)), oneMinusEpsilon)
+}
+
+func (s *haltonSampler) Get2D() (float32, float32) {
+	return s.Get1D(), s.Get1D()
+}
+
+// scrambledRadicalInverse mirrors the digits of index in the base of dimension dim around the decimal point,
+// mapping every digit through a random linear permutation seeded by the digit's position. The digits past
+// the last one of index are zeros that are permuted too, so they are continued until float precision.
+func scrambledRadicalInverse(dim int, index, seed uint64) float64 {
+	base := haltonPrimes[dim]
+	invBase := 1 / float64(base)
+	result := 0.0
+	scale := invBase
+	for k := uint64(0); scale > 1e-9; k++ {
+		digit := index % base
+		index /= base
+		h := mixBits(seed ^ uint64(dim)<<40 ^ k)
+		a := uint64(1)
+		if base > 2 {
+			a = 1 + (h>>32)%(base-1)
+		}
+		permuted := (a*digit + h%base) % base
+		result += float64(permuted) * scale
+		scale *= invBase
+	}
+	return result
+}
+
+// firstPrimes are the first n prime numbers
+func firstPrimes(n int) []uint64 {
+	primes := make([]uint64, 0, n)
+	for candidate := uint64(2); len(primes) < n; candidate++ {
+		isPrime := true
+		for _, p := range primes {
+			if p*p > candidate {
+				break
+			}
+			if candidate%p == 0 {
+				isPrime = false
+				break
+			}
+		}
+		if isPrime {
+			primes = append(primes, candidate)
+		}
+	}
+	return primes
+}
+
+// sobolSampler pads 1D and 2D Sobol points together: every 1D sample is the Owen scrambled van der Corput
+// sequence and every 2D sample the first two dimensions of the Sobol sequence, scrambled the same way. Each
+// dimension shuffles the order of the points, so the dimensions of a sample are not correlated with each
+// other while each one is as evenly spread as Sobol points are.
+type sobolSampler struct {
+	pixelSample
+	samplesPerPixel int
+	seed            uint64
+}
+
+func (s *sobolSampler) StartPixelSample(i, j, index int) {
+	s.start(s.seed, i, j, index)
+}
+
+// shuffledIndex is the sample index permuted for the current dimension, which also gives the hash to
+// scramble it with
+func (s *sobolSampler) shuffledIndex() (uint32, uint64) {
+	h := s.dimensionHash()
+	index := uint32(s.index)
+	if s.index < s.samplesPerPixel {
+		index = permutationElement(index, uint32(s.samplesPerPixel), uint32(h))
+	}
+	return index, h
+}
+
+func (s *sobolSampler) Get1D() float32 {
+	index, h := s.shuffledIndex()
+	s.dim++
+	return uint32ToFloat(owenScramble(bits.Reverse32(index), uint32(h>>32)))
+}
+
+func (s *sobolSampler) Get2D() (float32, float32) {
+	index, h := s.shuffledIndex()
+	s.dim += 2
+	x := owenScramble(bits.Reverse32(index), uint32(h>>32))
+	y := owenScramble(sobolSecondDimension(index), uint32(mixBits(h)))
+	return uint32ToFloat(x), uint32ToFloat(y)
+}
+
+// sobolSecondDimension is the second dimension of the Sobol sequence, whose generator matrix is Pascal's
+// triangle mod 2. The first is the van der Corput sequence, the bit reversal of the index.
+func sobolSecondDimension(index uint32) uint32 {
+	v := uint32(1 << 31)
+	result := uint32(0)
+	for ; index != 0; index >>= 1 {
+		if index&1 != 0 {
+			result ^= v
+		}
+		v ^= v >> 1
+	}
+	return result
+}
+
+// owenScramble is the hash based nested uniform scramble of Laine and Karras, improved by Vegdahl. Every bit
+// of the fixed point value is flipped depending on the bits above it, which keeps the points stratified.
+func owenScramble(v, seed uint32) uint32 {
+	v = bits.Reverse32(v)
+	v ^= v * 0x3d20adea
+	v += seed
+	v *= (seed >> 16) | 1
+	v ^= v * 0x05526c56
+	v ^= v * 0x53a22864
+	return bits.Reverse32(v)
+}
+
+// permutationElement is the i-th element of a random permutation of [0, n) picked by seed, from Kensler's
+// Correlated Multi-Jittered Sampling. It hashes within the next power of two and walks the cycle until it
+// lands below n.
+func permutationElement(i, n, seed uint32) uint32 {
+	w := n - 1
+	w |= w >> 1
+	w |= w >> 2
+	w |= w >> 4
+	w |= w >> 8
+	w |= w >> 16
+	for {
+		i ^= seed
+		i *= 0xe170893d
+		i ^= seed >> 16
+		i ^= (i & w) >> 4
+		i ^= seed >> 8
+		i *= 0x0929eb3f
+		i ^= seed >> 23
+		i ^= (i & w) >> 1
+		i *= 1 | seed>>27
+		i *= 0x6935fa69
+		i ^= (i & w) >> 11
+		i *= 0x74dcb303
+		i ^= (i & w) >> 2
+		i *= 0x9e501cc3
+		i ^= (i & w) >> 2
+		i *= 0xc860a3df
+		i &= w
+		i ^= i >> 5
+		if i < n {
+			return (i + seed) % n
+		}
+	}
+}
+
+// oneMinusEpsilon is the largest float32 below 1
+const oneMinusEpsilon = float32(0x1.fffffep-1)
+
+// uint32ToFloat maps the fixed point fraction v to [0, 1)
+func uint32ToFloat(v uint32) float32 {
+	return float32(v>>8) * 0x1p-24
+}
+
+// mixBits is the SplitMix64 finalizer, which turns similar inputs into unrelated outputs
+func mixBits(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
@@ -0,0 +1,118 @@
+package internal
+
+import "testing"
+
+func TestPermutationElement(t *testing.T) {
+	for _, n := range []uint32{1, 2, 7, 16, 100} {
+		for _, seed := range []uint32{0, 1, 0xdeadbeef} {
+			seen := make([]bool, n)
+			for i := uint32(0); i < n; i++ {
+				p := permutationElement(i, n, seed)
+				if p >= n || seen[p] {
+					t.Fatalf("n %d seed %#x: element %d is %d, not a permutation", n, seed, i, p)
+				}
+				seen[p] = true
+			}
+		}
+	}
+}
+
+// TestSamplersStratify checks that the samples of a pixel fall one in every stratum of a 1D dimension and one
+// in every cell of a 2D one, for the samplers that promise it with a square, power of two sample count
+func TestSamplersStratify(t *testing.T) {
+	const spp = 16
+	for _, kind := range []SamplerKind{SamplerStratified, SamplerSobol} {
+		s := newSampler(kind, spp, 7)
+		var strata [spp]int
+		var cells [4][4]int
+		for index := 0; index < spp; index++ {
+			s.StartPixelSample(3, 5, index)
+			s.StartDimension(bounceDimension(2))
+			strata[int(s.Get1D()*spp)]++
+			x, y := s.Get2D()
+			cells[int(x*4)][int(y*4)]++
+		}
+		for k, n := range strata {
+			if n != 1 {
+				t.Errorf("%s: %d samples in 1D stratum %d, want 1", kind, n, k)
+			}
+		}
+		for x := range cells {
+			for y, n := range cells[x] {
+				if n != 1 {
+					t.Errorf("%s: %d samples in 2D cell (%d, %d), want 1", kind, n, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestSamplersStayInRange(t *testing.T) {
+	for kind := range samplerNames {
+		s := newSampler(SamplerKind(kind), 9, 3)
+		for index := 0; index < 9; index++ {
+			s.StartPixelSample(index, 2*index, index)
+			for dim := 0; dim < 50; dim++ {
+				x, y := s.Get2D()
+				for _, v := range []float32{s.Get1D(), x, y} {
+					if v < 0 || v >= 1 {
+						t.Fatalf("%s: sample %d gave %v, outside [0, 1)", SamplerKind(kind), index, v)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestStartDimensionNeverGoesBack(t *testing.T) {
+	s := newSampler(SamplerSobol, 4, 1).(*sobolSampler)
+	s.StartPixelSample(0, 0, 0)
+	s.StartDimension(bounceDimension(0))
+	for k := 0; k < bounceDimensions+2; k++ {
+		s.Get1D()
+	}
+	s.StartDimension(bounceDimension(1))
+	if want := bounceDimension(0) + bounceDimensions + 2; s.dim != want {
+		t.Errorf("dimension %d after overflowing a bounce, want %d", s.dim, want)
+	}
+	s.StartDimension(bounceDimension(3))
+	if s.dim != bounceDimension(3) {
+		t.Errorf("dimension %d, want %d", s.dim, bounceDimension(3))
+	}
+}
+
+func TestParseSampler(t *testing.T) {
+	for kind := range samplerNames {
+		got, err := ParseSampler(SamplerKind(kind).String())
+		if err != nil || got != SamplerKind(kind) {
+			t.Errorf("ParseSampler(%q) = %v, %v", SamplerKind(kind).String(), got, err)
+		}
+	}
+	if _, err := ParseSampler("random"); err == nil {
+		t.Error("ParseSampler(\"random\") did not fail")
+	}
+}
+
+// TestIndependent1DLeavesDimensions draws from the independent stream in the middle of a sample, as a medium
+// does during traversal. The dimensions after it should be the same as without the extra draws.
+func TestIndependent1DLeavesDimensions(t *testing.T) {
+	for kind := range samplerNames {
+		plain := newSampler(SamplerKind(kind), 16, 5)
+		drawing := newSampler(SamplerKind(kind), 16, 5)
+		for index := 0; index < 16; index++ {
+			plain.StartPixelSample(2, 3, index)
+			drawing.StartPixelSample(2, 3, index)
+			for dim := 0; dim < 20; dim++ {
+				for k := 0; k < dim%3; k++ {
+					if u := drawing.Independent1D(); u < 0 || u >= 1 {
+						t.Fatalf("%s: Independent1D gave %v", SamplerKind(kind), u)
+					}
+				}
+				if want, got := plain.Get1D(), drawing.Get1D(); got != want {
+					t.Fatalf("%s: sample %d dimension %d is %v with independent draws, want %v",
+						SamplerKind(kind), index, dim, got, want)
+				}
+			}
+		}
+	}
+}
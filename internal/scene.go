@@ -0,0 +1,534 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// SceneFile is the JSON description of a camera and the world it looks at.
+// Textures and materials are declared by name and referenced by name from materials and primitives.
+type SceneFile struct {
+	// Seed seeds the camera and any noise texture without a seed of its own
+	Seed       int64                   `json:"seed"`
+	Camera     CameraDesc              `json:"camera"`
+	Textures   map[string]TextureDesc  `json:"textures"`
+	Materials  map[string]MaterialDesc `json:"materials"`
+	Primitives []PrimitiveDesc         `json:"primitives"`
+}
+
+// JSONVec3 is a Vec3 written as [x, y, z]
+type JSONVec3 [3]float32
+
+func (v JSONVec3) Vec3() Vec3 {
+	return NewVec3(v[0], v[1], v[2])
+}
+
+// CameraDesc holds the camera settings. Shutter is the [open, close] time interval used for motion blur.
+// An environment or a sky replaces the background color. Exposure is in EV, toneMap is linear, reinhard or
+// aces and sampler is independent, stratified, halton or sobol.
+type CameraDesc struct {
+	AspectRatio     float32          `json:"aspectRatio"`
+	Width           int              `json:"width"`
+	SamplesPerPixel int              `json:"samplesPerPixel"`
+	MaxDepth        int              `json:"maxDepth"`
+	LookFrom        *JSONVec3        `json:"lookFrom"`
+	LookAt          *JSONVec3        `json:"lookAt"`
+	FOV             float32          `json:"fov"`
+	DefocusAngle    float32          `json:"defocusAngle"`
+	FocusDist       float32          `json:"focusDist"`
+	Background      *JSONVec3        `json:"background"`
+	Shutter         *[2]float32      `json:"shutter"`
+	Environment     *EnvironmentDesc `json:"environment"`
+	Sky             *SkyDesc         `json:"sky"`
+	Exposure        float32          `json:"exposure"`
+	ToneMap         string           `json:"toneMap"`
+	Adaptive        *AdaptiveDesc    `json:"adaptive"`
+	Sampler         string           `json:"sampler"`
+}
+
+// AdaptiveDesc turns on adaptive sampling, with samplesPerPixel as the most a pixel can take,
+//
+//	{"minSamples": 16, "threshold": 0.05}
+type AdaptiveDesc struct {
+	MinSamples int     `json:"minSamples"`
+	Threshold  float32 `json:"threshold"`
+}
+
+// EnvironmentDesc is an equirectangular image lighting the scene,
+//
+//	{"path": "relative/to/scene.hdr", "rotation": degrees, "intensity": i}
+//
+// The image is a Radiance .hdr or a .pfm. Rotation turns it around the y axis and intensity defaults to 1.
+type EnvironmentDesc struct {
+	Path      string   `json:"path"`
+	Rotation  float32  `json:"rotation"`
+	Intensity *float32 `json:"intensity"`
+}
+
+// SkyDesc is a procedural daylight sky with a sun,
+//
+//	{"sunElevation": degrees, "sunAzimuth": degrees, "turbidity": t, "sunRadius": degrees, "intensity": i}
+//
+// Everything is optional, see NewSky for the defaults.
+type SkyDesc struct {
+	SunElevation *float32 `json:"sunElevation"`
+	SunAzimuth   float32  `json:"sunAzimuth"`
+	Turbidity    *float32 `json:"turbidity"`
+	SunRadius    *float32 `json:"sunRadius"`
+	Intensity    *float32 `json:"intensity"`
+}
+
+func (sd SkyDesc) Build() *Sky {
+	opts := []SkyOpt{WithSunAzimuth(sd.SunAzimuth)}
+	if sd.SunElevation != nil {
+		opts = append(opts, WithSunElevation(*sd.SunElevation))
+	}
+	if sd.Turbidity != nil {
+		opts = append(opts, WithTurbidity(*sd.Turbidity))
+	}
+	if sd.SunRadius != nil {
+		opts = append(opts, WithSunAngularRadius(*sd.SunRadius))
+	}
+	if sd.Intensity != nil {
+		opts = append(opts, WithSkyIntensity(*sd.Intensity))
+	}
+	return NewSky(opts...)
+}
+
+func (ed EnvironmentDesc) Build(baseDir string) (*EnvironmentMap, error) {
+	path := ed.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	img, err := LoadHDRImage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []EnvironmentMapOpt{WithEnvironmentRotation(ed.Rotation)}
+	if ed.Intensity != nil {
+		opts = append(opts, WithEnvironmentIntensity(*ed.Intensity))
+	}
+	return NewEnvironmentMap(img, opts...), nil
+}
+
+// TextureDesc is one of
+//
+//	{"type": "solid", "color": [r, g, b]}
+//	{"type": "checkered", "scale": s, "even": [r, g, b], "odd": [r, g, b]}
+//	{"type": "image", "path": "relative/to/scene.jpg"}
+//	{"type": "noise", "scale": s, "seed": n}
+type TextureDesc struct {
+	Type  string   `json:"type"`
+	Color JSONVec3 `json:"color"`
+	Scale float32  `json:"scale"`
+	Even  JSONVec3 `json:"even"`
+	Odd   JSONVec3 `json:"odd"`
+	Path  string   `json:"path"`
+	Seed  *int64   `json:"seed"`
+}
+
+// MaterialDesc is one of
+//
+//	{"type": "lambertian", "texture": "name"} or {"type": "lambertian", "albedo": [r, g, b]}
+//	{"type": "metal", "albedo": [r, g, b], "fuzz": f}
+//	{"type": "dielectric", "refractiveIndex": n}
+//	{"type": "diffuseLight", "texture": "name"} or {"type": "diffuseLight", "emit": [r, g, b]}
+//	{"type": "isotropic", "texture": "name"} or {"type": "isotropic", "albedo": [r, g, b]}
+type MaterialDesc struct {
+	Type            string    `json:"type"`
+	Texture         string    `json:"texture"`
+	Albedo          *JSONVec3 `json:"albedo"`
+	Emit            *JSONVec3 `json:"emit"`
+	Fuzz            float32   `json:"fuzz"`
+	RefractiveIndex float32   `json:"refractiveIndex"`
+}
+
+// PrimitiveDesc is one of
+//
+//	{"type": "sphere", "center": [x, y, z], "center1": [x, y, z], "radius": r, "material": "name"}
+//	{"type": "quad", "q": [x, y, z], "u": [x, y, z], "v": [x, y, z], "material": "name"}
+//	{"type": "box", "min": [x, y, z], "max": [x, y, z], "material": "name"}
+//	{"type": "triangle", "vertices": [[x, y, z] x3], "normals": [[x, y, z] x3], "uvs": [[u, v] x3], "material": "name"}
+//	{"type": "obj", "path": "relative/to/scene.obj"}
+//	{"type": "medium", "boundary": {primitive}, "density": d, "material": "name"}
+//
+// A sphere with a center1 moves from center at time 0 to center1 at time 1, blurred by the camera shutter.
+// The normals and uvs of a triangle are optional. An obj mesh takes its materials from its mtllib.
+// A medium fills its boundary, a sphere or box that needs no material, with fog scattered by its material,
+// usually isotropic.
+// Any primitive can also have "scale": [x, y, z], "rotate": [x, y, z] in degrees and "translate": [x, y, z],
+// applied in that order. No component of the scale may be 0.
+type PrimitiveDesc struct {
+	Type      string         `json:"type"`
+	Material  string         `json:"material"`
+	Center    JSONVec3       `json:"center"`
+	Center1   *JSONVec3      `json:"center1"`
+	Radius    float32        `json:"radius"`
+	Q         JSONVec3       `json:"q"`
+	U         JSONVec3       `json:"u"`
+	V         JSONVec3       `json:"v"`
+	Min       JSONVec3       `json:"min"`
+	Max       JSONVec3       `json:"max"`
+	Vertices  []JSONVec3     `json:"vertices"`
+	Normals   []JSONVec3     `json:"normals"`
+	UVs       [][2]float32   `json:"uvs"`
+	Path      string         `json:"path"`
+	Boundary  *PrimitiveDesc `json:"boundary"`
+	Density   float32        `json:"density"`
+	Scale     *JSONVec3      `json:"scale"`
+	Rotate    *JSONVec3      `json:"rotate"`
+	Translate *JSONVec3      `json:"translate"`
+}
+
+// LoadScene reads a JSON scene file and builds its camera and world. Relative image paths are resolved from
+// the directory of the scene file. Overrides are applied after the camera settings of the file. The world is
+// returned without a BVH so the caller can choose how to build one.
+func LoadScene(fname string, overrides ...CameraOpt) (*Camera, *World, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	return ParseScene(f, filepath.Dir(fname), overrides...)
+}
+
+func ParseScene(r io.Reader, baseDir string, overrides ...CameraOpt) (*Camera, *World, error) {
+	var sf SceneFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sf); err != nil {
+		return nil, nil, fmt.Errorf("decoding scene: %w", err)
+	}
+
+	world, err := sf.BuildWorld(baseDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aspectRatio, width, opts := sf.Camera.Options()
+	opts = append(opts, WithSeed(sf.Seed))
+	if sf.Camera.Environment != nil {
+		env, err := sf.Camera.Environment.Build(baseDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("environment: %w", err)
+		}
+		opts = append(opts, WithEnvironment(env))
+	}
+	if sf.Camera.Sky != nil {
+		opts = append(opts, WithEnvironment(sf.Camera.Sky.Build()))
+	}
+	if sf.Camera.ToneMap != "" {
+		tm, err := ParseToneMapper(sf.Camera.ToneMap)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, WithToneMapper(tm))
+	}
+	if sf.Camera.Sampler != "" {
+		kind, err := ParseSampler(sf.Camera.Sampler)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, WithSampler(kind))
+	}
+	camera := NewCamera(aspectRatio, width, append(opts, overrides...)...)
+
+	return camera, world, nil
+}
+
+// Options converts the description into NewCamera arguments. Anything left out keeps the camera defaults.
+func (cd CameraDesc) Options() (float32, int, []CameraOpt) {
+	aspectRatio := cd.AspectRatio
+	if aspectRatio <= 0 {
+		aspectRatio = 16.0 / 9.0
+	}
+	width := cd.Width
+	if width <= 0 {
+		width = 400
+	}
+
+	var opts []CameraOpt
+	if cd.SamplesPerPixel > 0 {
+		opts = append(opts, WithSamplesPerPixel(cd.SamplesPerPixel))
+	}
+	if cd.MaxDepth > 0 {
+		opts = append(opts, WithMaxRayDepth(cd.MaxDepth))
+	}
+	if cd.LookFrom != nil {
+		opts = append(opts, WithLookFrom(cd.LookFrom.Vec3()))
+	}
+	if cd.LookAt != nil {
+		opts = append(opts, WithLookAt(cd.LookAt.Vec3()))
+	}
+	if cd.FOV > 0 {
+		opts = append(opts, WithFOVDegrees(cd.FOV))
+	}
+	if cd.DefocusAngle > 0 {
+		opts = append(opts, WithDefocusAngleDegrees(cd.DefocusAngle))
+	}
+	if cd.FocusDist > 0 {
+		opts = append(opts, WithFocusDist(cd.FocusDist))
+	}
+	if cd.Background != nil {
+		opts = append(opts, WithBackgroundColor(cd.Background.Vec3()))
+	}
+	if cd.Shutter != nil {
+		opts = append(opts, WithShutter(cd.Shutter[0], cd.Shutter[1]))
+	}
+	if cd.Exposure != 0 {
+		opts = append(opts, WithExposure(cd.Exposure))
+	}
+	if cd.Adaptive != nil {
+		opts = append(opts, WithAdaptiveSampling(cd.Adaptive.MinSamples, cd.Adaptive.Threshold))
+	}
+
+	return aspectRatio, width, opts
+}
+
+// BuildWorld creates every texture, material and primitive of the scene. A scene without primitives is an
+// error, there would be nothing to render.
+func (sf *SceneFile) BuildWorld(baseDir string) (*World, error) {
+	textures := make(map[string]Texture, len(sf.Textures))
+	for name, td := range sf.Textures {
+		tex, err := td.Build(baseDir, textureSeed(sf.Seed, name))
+		if err != nil {
+			return nil, fmt.Errorf("texture %q: %w", name, err)
+		}
+		textures[name] = tex
+	}
+
+	materials := make(map[string]Material, len(sf.Materials))
+	for name, md := range sf.Materials {
+		mat, err := md.Build(textures)
+		if err != nil {
+			return nil, fmt.Errorf("material %q: %w", name, err)
+		}
+		materials[name] = mat
+	}
+
+	world := NewWorld()
+	for i, pd := range sf.Primitives {
+		if pd.Type == "obj" {
+			path := pd.Path
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(baseDir, path)
+			}
+			mesh, err := LoadOBJ(path)
+			if err != nil {
+				return nil, fmt.Errorf("primitive %d: %w", i, err)
+			}
+			transformed, err := pd.transform([]Hittable{mesh})
+			if err != nil {
+				return nil, fmt.Errorf("primitive %d: %w", i, err)
+			}
+			world.Add(transformed...)
+			continue
+		}
+
+		mat, ok := materials[pd.Material]
+		if !ok {
+			return nil, fmt.Errorf("primitive %d: unknown material %q", i, pd.Material)
+		}
+		hittables, err := pd.Build(mat)
+		if err != nil {
+			return nil, fmt.Errorf("primitive %d: %w", i, err)
+		}
+		hittables, err = pd.transform(hittables)
+		if err != nil {
+			return nil, fmt.Errorf("primitive %d: %w", i, err)
+		}
+		world.Add(hittables...)
+	}
+	if len(sf.Primitives) == 0 {
+		return nil, fmt.Errorf("scene has no primitives")
+	}
+
+	return world, nil
+}
+
+// textureSeed gives every texture of a scene its own seed, whatever order the textures are built in
+func textureSeed(sceneSeed int64, name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return sceneSeed ^ int64(h.Sum64())
+}
+
+// Build creates the texture. seed is used by noise textures that do not set their own.
+func (td TextureDesc) Build(baseDir string, seed int64) (Texture, error) {
+	switch td.Type {
+	case "solid":
+		return NewSolidColor(td.Color[0], td.Color[1], td.Color[2]), nil
+	case "checkered":
+		tex := NewCheckered(td.Scale, td.Even.Vec3(), td.Odd.Vec3())
+		return &tex, nil
+	case "image":
+		path := td.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		img, err := LoadImage(path)
+		if err != nil {
+			return nil, err
+		}
+		tex := NewImageTexture(img)
+		return &tex, nil
+	case "noise":
+		if td.Seed != nil {
+			seed = *td.Seed
+		}
+		tex := NewNoiseTexture(rand.New(rand.NewSource(seed)), td.Scale)
+		return &tex, nil
+	default:
+		return nil, fmt.Errorf("unknown texture type %q", td.Type)
+	}
+}
+
+// texture resolves the named texture, falling back to a solid color
+func (md MaterialDesc) texture(textures map[string]Texture, fallback *JSONVec3) (Texture, error) {
+	if md.Texture != "" {
+		tex, ok := textures[md.Texture]
+		if !ok {
+			return nil, fmt.Errorf("unknown texture %q", md.Texture)
+		}
+		return tex, nil
+	}
+	if fallback == nil {
+		return nil, fmt.Errorf("%s needs a texture or a color", md.Type)
+	}
+	return NewSolidColor(fallback[0], fallback[1], fallback[2]), nil
+}
+
+func (md MaterialDesc) Build(textures map[string]Texture) (Material, error) {
+	switch md.Type {
+	case "lambertian":
+		tex, err := md.texture(textures, md.Albedo)
+		if err != nil {
+			return nil, err
+		}
+		mat := NewLambertian(tex)
+		return &mat, nil
+	case "metal":
+		if md.Albedo == nil {
+			return nil, fmt.Errorf("metal needs an albedo")
+		}
+		mat := NewMetal(md.Albedo.Vec3(), md.Fuzz)
+		return &mat, nil
+	case "dielectric":
+		if md.RefractiveIndex <= 0 {
+			return nil, fmt.Errorf("dielectric needs a positive refractiveIndex, got %v", md.RefractiveIndex)
+		}
+		mat := NewDielectric(md.RefractiveIndex)
+		return &mat, nil
+	case "diffuseLight":
+		tex, err := md.texture(textures, md.Emit)
+		if err != nil {
+			return nil, err
+		}
+		mat := NewDiffuseLight(tex)
+		return &mat, nil
+	case "isotropic":
+		tex, err := md.texture(textures, md.Albedo)
+		if err != nil {
+			return nil, err
+		}
+		mat := NewIsotropic(tex)
+		return &mat, nil
+	default:
+		return nil, fmt.Errorf("unknown material type %q", md.Type)
+	}
+}
+
+func (pd PrimitiveDesc) Build(mat Material) ([]Hittable, error) {
+	switch pd.Type {
+	case "sphere":
+		if pd.Center1 != nil {
+			return []Hittable{NewMovingSphere(pd.Center.Vec3(), pd.Center1.Vec3(), 0, 1, pd.Radius, mat)}, nil
+		}
+		return []Hittable{NewSphere(pd.Center.Vec3(), pd.Radius, mat)}, nil
+	case "quad":
+		return []Hittable{NewQuad(pd.Q.Vec3(), pd.U.Vec3(), pd.V.Vec3(), mat)}, nil
+	case "box":
+		return Box(pd.Min.Vec3(), pd.Max.Vec3(), mat), nil
+	case "triangle":
+		if len(pd.Vertices) != 3 {
+			return nil, fmt.Errorf("triangle needs 3 vertices, got %d", len(pd.Vertices))
+		}
+		var opts []TriangleOpt
+		if len(pd.Normals) > 0 {
+			if len(pd.Normals) != 3 {
+				return nil, fmt.Errorf("triangle needs 3 normals, got %d", len(pd.Normals))
+			}
+			opts = append(opts, WithVertexNormals(pd.Normals[0].Vec3(), pd.Normals[1].Vec3(), pd.Normals[2].Vec3()))
+		}
+		if len(pd.UVs) > 0 {
+			if len(pd.UVs) != 3 {
+				return nil, fmt.Errorf("triangle needs 3 uvs, got %d", len(pd.UVs))
+			}
+			opts = append(opts, WithVertexUVs(
+				TexCoord{U: pd.UVs[0][0], V: pd.UVs[0][1]},
+				TexCoord{U: pd.UVs[1][0], V: pd.UVs[1][1]},
+				TexCoord{U: pd.UVs[2][0], V: pd.UVs[2][1]},
+			))
+		}
+		return []Hittable{NewTriangle(pd.Vertices[0].Vec3(), pd.Vertices[1].Vec3(), pd.Vertices[2].Vec3(), mat, opts...)}, nil
+	case "medium":
+		if pd.Boundary == nil {
+			return nil, fmt.Errorf("medium needs a boundary")
+		}
+		if pd.Density <= 0 {
+			return nil, fmt.Errorf("medium needs a positive density, got %v", pd.Density)
+		}
+		boundary, err := pd.Boundary.Build(nil)
+		if err != nil {
+			return nil, fmt.Errorf("boundary: %w", err)
+		}
+		boundary, err = pd.Boundary.transform(boundary)
+		if err != nil {
+			return nil, fmt.Errorf("boundary: %w", err)
+		}
+		return []Hittable{NewConstantMedium(group(boundary), pd.Density, mat)}, nil
+	default:
+		return nil, fmt.Errorf("unknown primitive type %q", pd.Type)
+	}
+}
+
+// transform wraps the hittables of a primitive in its scale, rotation and translation, if it has any. A scale
+// of 0 along any axis flattens the primitive and is an error, as the transform cannot be inverted.
+func (pd PrimitiveDesc) transform(hittables []Hittable) ([]Hittable, error) {
+	if pd.Scale == nil && pd.Rotate == nil && pd.Translate == nil {
+		return hittables, nil
+	}
+
+	m := NewMat4Identity()
+	if pd.Scale != nil {
+		m = MulMat4(NewMat4Scale(pd.Scale.Vec3()), m)
+	}
+	if pd.Rotate != nil {
+		m = MulMat4(NewMat4EulerDegrees(pd.Rotate.Vec3()), m)
+	}
+	if pd.Translate != nil {
+		m = MulMat4(NewMat4Translate(pd.Translate.Vec3()), m)
+	}
+
+	if _, ok := m.Inverse(); !ok {
+		return nil, fmt.Errorf("%s: singular transform, it cannot be inverted", pd.Type)
+	}
+	return []Hittable{NewTransform(group(hittables), m)}, nil
+}
+
+// group returns the only hittable, or a world holding all of them
+func group(hittables []Hittable) Hittable {
+	if len(hittables) == 1 {
+		return hittables[0]
+	}
+	w := NewWorld()
+	w.Add(hittables...)
+	return w
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSceneFiles(t *testing.T) {
+	files, err := filepath.Glob("../scenes/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no scene files found")
+	}
+
+	wantLights := map[string]int{
+		"cornellBox.json":   1,
+		"cornellSmoke.json": 1,
+		"spheres.json":      0,
+	}
+	materialIDs := func(world *World) []uint32 {
+		world.NumberMaterials()
+		var ids []uint32
+		visitMaterials(world, func(m Material) {
+			ids = append(ids, m.(interface{ ID() uint32 }).ID())
+		})
+		return ids
+	}
+	for _, fname := range files {
+		name := filepath.Base(fname)
+		camera, world, err := LoadScene(fname)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if camera == nil || len(world.hittables) == 0 {
+			t.Errorf("%s: loaded without a camera or anything to render", name)
+		}
+		if want, ok := wantLights[name]; ok && world.Lights().Len() != want {
+			t.Errorf("%s: %d lights, want %d", name, world.Lights().Len(), want)
+		}
+
+		// Materials are built from a map, the IDs must not depend on the order it is walked in
+		_, again, err := LoadScene(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, second := materialIDs(world), materialIDs(again)
+		for i := range first {
+			if first[i] != second[i] {
+				t.Errorf("%s: material IDs %v then %v, want the same each time", name, first, second)
+				break
+			}
+		}
+	}
+}
+
+func TestParseSceneErrors(t *testing.T) {
+	const camera = `"camera": {"width": 16}`
+	tests := []struct {
+		name  string
+		scene string
+		want  string
+	}{
+		{"empty", `{}`, `no primitives`},
+		{"only a camera", `{` + camera + `}`, `no primitives`},
+		{
+			"unknown material",
+			`{` + camera + `, "primitives": [{"type": "sphere", "radius": 1, "material": "missing"}]}`,
+			`unknown material "missing"`,
+		},
+		{
+			"unknown texture",
+			`{` + camera + `, "materials": {"m": {"type": "lambertian", "texture": "missing"}}}`,
+			`unknown texture "missing"`,
+		},
+		{
+			"unknown material type",
+			`{` + camera + `, "materials": {"m": {"type": "plastic"}}}`,
+			`unknown material type "plastic"`,
+		},
+		{
+			"unknown texture type",
+			`{` + camera + `, "textures": {"t": {"type": "wood"}}}`,
+			`unknown texture type "wood"`,
+		},
+		{
+			"unknown primitive type",
+			`{` + camera + `, "materials": {"m": {"type": "lambertian", "albedo": [1, 1, 1]}},
+				"primitives": [{"type": "torus", "material": "m"}]}`,
+			`torus`,
+		},
+		{
+			"zero refractive index",
+			`{` + camera + `, "materials": {"glass": {"type": "dielectric"}}}`,
+			`positive refractiveIndex`,
+		},
+		{
+			"negative refractive index",
+			`{` + camera + `, "materials": {"glass": {"type": "dielectric", "refractiveIndex": -1.5}}}`,
+			`positive refractiveIndex`,
+		},
+		{
+			"metal without albedo",
+			`{` + camera + `, "materials": {"m": {"type": "metal"}}}`,
+			`metal needs an albedo`,
+		},
+		{
+			"flattened by a zero scale",
+			`{` + camera + `, "materials": {"m": {"type": "lambertian", "albedo": [1, 1, 1]}},
+				"primitives": [{"type": "sphere", "radius": 1, "material": "m"},
+					{"type": "box", "min": [0, 0, 0], "max": [1, 1, 1], "scale": [0, 1, 1], "material": "m"}]}`,
+			`primitive 1: box: singular transform`,
+		},
+		{
+			"flattened medium boundary",
+			`{` + camera + `, "materials": {"m": {"type": "isotropic", "albedo": [1, 1, 1]}},
+				"primitives": [{"type": "medium", "density": 1, "material": "m",
+					"boundary": {"type": "sphere", "radius": 1, "scale": [1, 0, 1]}}]}`,
+			`boundary: sphere: singular transform`,
+		},
+		{
+			"unknown field",
+			`{` + camera + `, "lights": []}`,
+			`unknown field "lights"`,
+		},
+	}
+	for _, tt := range tests {
+		_, _, err := ParseScene(strings.NewReader(tt.scene), ".")
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %q, want it to mention %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"math"
+)
+
+// skyRadianceScale brings the sky luminance of the Preetham model, in kcd/m², to the range of the other lights
+// in the renderer, where a clear zenith is a few tenths
+const skyRadianceScale = 0.05
+
+// sunIrradiance is the light falling on a surface facing a sun at the zenith before the atmosphere dims it,
+// roughly five times what the whole sky gives at midday as it is outside
+const sunIrradiance = 5
+
+// Sky is the Preetham analytic daylight model with a sun disc. Its radiance depends on the direction of the
+// sun and the turbidity, the haziness of the air, from about 2 for a clear sky to 10 for a hazy one. It is
+// also an Emitter that samples the sun, so it casts sharp or soft shadows depending on the sun's angular radius.
+//
+// Below the horizon the sky has the color of the horizon at the same angle from the sun, so it carries on
+// without a seam where there is no ground.
+type Sky struct {
+	sunElevation     float32
+	sunAzimuth       float32
+	sunRadiusRadians float32
+	turbidity        float32
+	intensity        float32
+	sunDir           Vec3
+	cosSunRadius     float32
+	sunRadiance      Vec3
+	// zenith is the luminance and chromaticity straight up, which perez distributes over the sky for
+	// Y, x and y in turn
+	zenith        [3]float32
+	perez         [3][5]float32
+	perezAtZenith [3]float32
+}
+
+type SkyOpt func(*Sky)
+
+// WithSunElevation sets how many degrees the sun is above the horizon, clamped to [0, 90]
+func WithSunElevation(degrees float32) SkyOpt {
+	return func(s *Sky) {
+		s.sunElevation = ToRadians(Clamp(0, 90, degrees))
+	}
+}
+
+// WithSunAzimuth turns the sun around the up axis, from -z at 0 degrees towards +x at 90 degrees
+func WithSunAzimuth(degrees float32) SkyOpt {
+	return func(s *Sky) {
+		s.sunAzimuth = ToRadians(degrees)
+	}
+}
+
+// WithTurbidity sets the haziness of the air, clamped to the [1.7, 10] range the model was fit for
+func WithTurbidity(turbidity float32) SkyOpt {
+	return func(s *Sky) {
+		s.turbidity = Clamp(1.7, 10, turbidity)
+	}
+}
+
+// WithSunAngularRadius sets the apparent size of the sun. Larger suns give softer shadows while lighting the
+// world just as brightly.
+func WithSunAngularRadius(degrees float32) SkyOpt {
+	return func(s *Sky) {
+		s.sunRadiusRadians = ToRadians(degrees)
+	}
+}
+
+// WithSkyIntensity scales the radiance of both the sky and the sun
+func WithSkyIntensity(intensity float32) SkyOpt {
+	return func(s *Sky) {
+		s.intensity = intensity
+	}
+}
+
+func NewSky(opts ...SkyOpt) *Sky {
+	s := &Sky{
+		turbidity:        2.5,
+		intensity:        1,
+		sunElevation:     ToRadians(45),
+		sunRadiusRadians: ToRadians(0.265),
+	}
+	for _, fn := range opts {
+		fn(s)
+	}
+
+	cosElevation := float32(math.Cos(float64(s.sunElevation)))
+	s.sunDir = NewVec3(
+		cosElevation*float32(math.Sin(float64(s.sunAzimuth))),
+		float32(math.Sin(float64(s.sunElevation))),
+		-cosElevation*float32(math.Cos(float64(s.sunAzimuth))),
+	)
+	thetaSun := float32(PiO2) - s.sunElevation
+	s.cosSunRadius = float32(math.Cos(float64(s.sunRadiusRadians)))
+
+	t := s.turbidity
+	s.perez = [3][5]float32{
+		{0.1787*t - 1.4630, -0.3554*t + 0.4275, -0.0227*t + 5.3251, 0.1206*t - 2.5771, -0.0670*t + 0.3703},
+		{-0.0193*t - 0.2592, -0.0665*t + 0.0008, -0.0004*t + 0.2125, -0.0641*t - 0.8989, -0.0033*t + 0.0452},
+		{-0.0167*t - 0.2608, -0.0950*t + 0.0092, -0.0079*t + 0.2102, -0.0441*t - 1.6537, -0.0109*t + 0.0529},
+	}
+	s.zenith = skyZenith(t, thetaSun)
+	for k := range s.perez {
+		s.perezAtZenith[k] = perezF(s.perez[k], 0, thetaSun)
+	}
+
+	solidAngle := 2 * PiF32 * (1 - s.cosSunRadius)
+	s.sunRadiance = Scale(sunTransmittance(t, thetaSun), sunIrradiance/solidAngle)
+
+	return s
+}
+
+// skyZenith is the luminance Y in kcd/m² and the chromaticity x, y of the zenith for a turbidity and sun
+// zenith angle
+func skyZenith(t, thetaSun float32) [3]float32 {
+	chi := (4.0/9.0 - t/120) * (PiF32 - 2*thetaSun)
+	luminance := (4.0453*t-4.9710)*float32(math.Tan(float64(chi))) - 0.2155*t + 2.4192
+
+	th := [4]float32{thetaSun * thetaSun * thetaSun, thetaSun * thetaSun, thetaSun, 1}
+	poly := func(coeffs [3][4]float32) float32 {
+		var rows [3]float32
+		for r := range coeffs {
+			for c := range th {
+				rows[r] += coeffs[r][c] * th[c]
+			}
+		}
+		return t*t*rows[0] + t*rows[1] + rows[2]
+	}
+	x := poly([3][4]float32{
+		{0.00166, -0.00375, 0.00209, 0},
+		{-0.02903, 0.06377, -0.03202, 0.00394},
+		{0.11693, -0.21196, 0.06052, 0.25886},
+	})
+	y := poly([3][4]float32{
+		{0.00275, -0.00610, 0.00317, 0},
+		{-0.04214, 0.08970, -0.04153, 0.00516},
+		{0.15346, -0.26756, 0.06670, 0.26688},
+	})
+
+	return [3]float32{luminance, x, y}
+}
+
+// perezF is the Perez sky distribution for a view zenith angle theta and angle gamma away from the sun
+func perezF(c [5]float32, theta, gamma float32) float32 {
+	cosTheta := MaxF32(float32(math.Cos(float64(theta))), 0.01)
+	cosGamma := float32(math.Cos(float64(gamma)))
+	return (1 + c[0]*float32(math.Exp(float64(c[1]/cosTheta)))) *
+		(1 + c[2]*float32(math.Exp(float64(c[3]*gamma))) + c[4]*cosGamma*cosGamma)
+}
+
+// sunTransmittance is how much of the red, green and blue sunlight gets through Rayleigh scattering and haze
+// on its way down from the sun zenith angle thetaSun
+func sunTransmittance(t, thetaSun float32) Vec3 {
+	thetaDegrees := float64(thetaSun) * 180 / math.Pi
+	// Relative optical mass, the length of the path through the air compared to looking straight up
+	m := 1 / (math.Cos(float64(thetaSun)) + 0.15*math.Pow(93.885-thetaDegrees, -1.253))
+	beta := 0.04608*float64(t) - 0.04586
+	const alpha = 1.3
+
+	transmit := func(lambdaMicrons float64) float32 {
+		rayleigh := math.Exp(-0.008735 * math.Pow(lambdaMicrons, -4.08) * m)
+		aerosol := math.Exp(-beta * math.Pow(lambdaMicrons, -alpha) * m)
+		return float32(rayleigh * aerosol)
+	}
+	return NewVec3(transmit(0.680), transmit(0.550), transmit(0.440))
+}
+
+// xyYToRGB converts a CIE xyY color into linear sRGB
+func xyYToRGB(x, y, luminance float32) Vec3 {
+	if y <= 0 {
+		return NewVec3Zero()
+	}
+	X := x / y * luminance
+	Z := (1 - x - y) / y * luminance
+	return NewVec3(
+		3.2406*X-1.5372*luminance-0.4986*Z,
+		-0.9689*X+1.8758*luminance+0.0415*Z,
+		0.0557*X-0.2040*luminance+1.0570*Z,
+	)
+}
+
+func (s *Sky) Radiance(dir Vec3) Vec3 {
+	dir = Unit(dir)
+	cosGamma := Clamp(-1, 1, Dot(dir, s.sunDir))
+
+	theta := float32(math.Acos(float64(Clamp(0, 1, dir.Y))))
+	gamma := float32(math.Acos(float64(cosGamma)))
+	var xyY [3]float32
+	for k := range xyY {
+		xyY[k] = s.zenith[k] * perezF(s.perez[k], theta, gamma) / s.perezAtZenith[k]
+	}
+	col := xyYToRGB(xyY[1], xyY[2], xyY[0]*skyRadianceScale)
+	col = NewVec3(MaxF32(col.X, 0), MaxF32(col.Y, 0), MaxF32(col.Z, 0))
+
+	if cosGamma >= s.cosSunRadius {
+		col.Add(s.sunRadiance)
+	}
+	return Scale(col, s.intensity)
+}
+
+// SunDirection is the unit direction towards the center of the sun
+func (s *Sky) SunDirection() Vec3 {
+	return s.sunDir
+}
+
+// PDFValue is uniform over the sun disc
+func (s *Sky) PDFValue(origin, dir Vec3) float32 {
+	if Dot(Unit(dir), s.sunDir) < s.cosSunRadius {
+		return 0
+	}
+	return 1 / (2 * PiF32 * (1 - s.cosSunRadius))
+}
+
+func (s *Sky) Random(origin Vec3, sampler Sampler) Vec3 {
+	return NewONB(s.sunDir).Local(randomInCone(s.cosSunRadius, sampler))
+}
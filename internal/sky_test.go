@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSkySunDirection(t *testing.T) {
+	cos30, sin30 := float32(math.Sqrt(3)/2), float32(0.5)
+	tests := []struct {
+		name               string
+		elevation, azimuth float32
+		want               Vec3
+	}{
+		{"sunrise ahead", 0, 0, NewVec3(0, 0, -1)},
+		{"noon", 90, 0, NewVec3(0, 1, 0)},
+		{"low in the east", 30, 90, NewVec3(cos30, sin30, 0)},
+		{"low behind", 30, 180, NewVec3(0, sin30, cos30)},
+		{"low in the west", 30, -90, NewVec3(-cos30, sin30, 0)},
+		{"past the zenith", 120, 0, NewVec3(0, 1, 0)},
+		{"below the horizon", -10, 0, NewVec3(0, 0, -1)},
+	}
+	for _, tt := range tests {
+		s := NewSky(WithSunElevation(tt.elevation), WithSunAzimuth(tt.azimuth))
+		if got := s.SunDirection(); !approxEqualVec3(got, tt.want, 1e-5) {
+			t.Errorf("%s: sun towards %v, want %v", tt.name, got, tt.want)
+		}
+		// The brightest direction should be the sun itself
+		if sun, beside := s.Radiance(s.SunDirection()), s.Radiance(Add(s.SunDirection(), NewVec3(0.1, 0.1, 0.1))); sun.Y <= beside.Y {
+			t.Errorf("%s: radiance %v towards the sun, no brighter than %v beside it", tt.name, sun, beside)
+		}
+	}
+}
+
+func TestSkyBelowHorizon(t *testing.T) {
+	const elevation = 30
+	s := NewSky(WithSunElevation(elevation))
+	cosElevation := math.Cos(elevation * math.Pi / 180)
+
+	for _, below := range []Vec3{Unit(NewVec3(1, -0.3, 0.2)), Unit(NewVec3(-0.5, -2, -1)), NewVec3(0, -1, 0)} {
+		got := s.Radiance(below)
+		if got.X < 0 || got.Y < 0 || got.Z < 0 || got.NearZero() {
+			t.Errorf("radiance %v along %v, want the sky to carry on below the horizon", got, below)
+			continue
+		}
+
+		// The horizon direction as far from the sun, which is towards -z
+		cosPhi := float64(Dot(below, s.SunDirection())) / cosElevation
+		phi := math.Acos(cosPhi)
+		horizon := NewVec3(float32(math.Sin(phi)), 0, -float32(math.Cos(phi)))
+		if want := s.Radiance(horizon); !approxEqualVec3(got, want, 1e-4) {
+			t.Errorf("radiance %v along %v, want %v as on the horizon along %v", got, below, want, horizon)
+		}
+	}
+
+	// No seam at the horizon
+	above, under := s.Radiance(NewVec3(1, 0.001, 0)), s.Radiance(NewVec3(1, -0.001, 0))
+	if !approxEqualVec3(above, under, 1e-3) {
+		t.Errorf("radiance %v just above the horizon and %v just below", above, under)
+	}
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ToneMapper compresses exposed linear radiance into the [0, 1] range a display can show
+type ToneMapper func(col Vec3) Vec3
+
+// ToneMapLinear clips everything brighter than 1, keeping the rest as it is
+func ToneMapLinear(col Vec3) Vec3 {
+	return NewVec3(Clamp(0, 1, col.X), Clamp(0, 1, col.Y), Clamp(0, 1, col.Z))
+}
+
+// ToneMapReinhard divides the color by one plus its luminance, which rolls highlights off smoothly towards white
+// without changing their hue
+func ToneMapReinhard(col Vec3) Vec3 {
+	return ToneMapLinear(Scale(col, 1/(1+luminance(col))))
+}
+
+// ToneMapACES is Krzysztof Narkowicz's fit of the ACES filmic curve. It darkens the shadows a little, adds
+// contrast to the midtones and desaturates highlights as they burn out like film does.
+func ToneMapACES(col Vec3) Vec3 {
+	aces := func(x float32) float32 {
+		const a, b, c, d, e = 2.51, 0.03, 2.43, 0.59, 0.14
+		x = MaxF32(x, 0)
+		return Clamp(0, 1, x*(a*x+b)/(x*(c*x+d)+e))
+	}
+	return NewVec3(aces(col.X), aces(col.Y), aces(col.Z))
+}
+
+var toneMappers = map[string]ToneMapper{
+	"linear":   ToneMapLinear,
+	"reinhard": ToneMapReinhard,
+	"aces":     ToneMapACES,
+}
+
+// ParseToneMapper finds a tone mapper by name: linear, reinhard or aces
+func ParseToneMapper(name string) (ToneMapper, error) {
+	tm, ok := toneMappers[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(toneMappers))
+		for n := range toneMappers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown tone mapper %q, want one of %s", name, strings.Join(names, ", "))
+	}
+	return tm, nil
+}
+
+// NewToneMapDisplay shows radiance the way a camera would: scaled by 2^exposureEV, compressed by tm and encoded
+// with the sRGB transfer function
+func NewToneMapDisplay(exposureEV float32, tm ToneMapper) DisplayFunc {
+	scale := float32(math.Exp2(float64(exposureEV)))
+	return func(col Vec3) Vec3 {
+		return DisplaySRGB(tm(Scale(col, scale)))
+	}
+}
+
+// DisplaySRGB clips linear values to [0, 1] and encodes them with the sRGB transfer function
+func DisplaySRGB(col Vec3) Vec3 {
+	return NewVec3(linearToSRGB(col.X), linearToSRGB(col.Y), linearToSRGB(col.Z))
+}
+
+// linearToSRGB is the sRGB OETF, a short linear segment near black followed by a 1/2.4 power curve
+func linearToSRGB(c float32) float32 {
+	c = Clamp(0, 1, c)
+	if c <= 0.0031308 {
+		return 12.92 * c
+	}
+	return 1.055*float32(math.Pow(float64(c), 1/2.4)) - 0.055
+}
@@ -0,0 +1,58 @@
+package internal
+
+import "testing"
+
+func TestLinearToSRGB(t *testing.T) {
+	tests := []struct {
+		linear, want float32
+	}{
+		{0, 0},
+		{0.0031308, 0.04045},
+		{0.18, 0.4614},
+		{0.5, 0.7354},
+		{1, 1},
+		{4, 1},
+		{-1, 0},
+	}
+	for _, tt := range tests {
+		if got := linearToSRGB(tt.linear); !approxEqual(got, tt.want, 1e-3) {
+			t.Errorf("linearToSRGB(%v) = %v, want %v", tt.linear, got, tt.want)
+		}
+	}
+}
+
+func TestToneMappersStayInRange(t *testing.T) {
+	for name, tm := range toneMappers {
+		prev := float32(-1)
+		for _, x := range []float32{0, 0.01, 0.1, 0.5, 1, 2, 10, 1000} {
+			got := tm(NewVec3(x, x, x)).X
+			if got < 0 || got > 1 {
+				t.Errorf("%s(%v) = %v, outside [0, 1]", name, x, got)
+			}
+			if got < prev {
+				t.Errorf("%s(%v) = %v, darker than a dimmer input at %v", name, x, got, prev)
+			}
+			prev = got
+		}
+	}
+}
+
+func TestToneMapDisplayExposure(t *testing.T) {
+	display := NewToneMapDisplay(1, ToneMapLinear)
+	got := display(NewVec3(0.25, 0.25, 0.25))
+	want := DisplaySRGB(NewVec3(0.5, 0.5, 0.5))
+	if !approxEqualVec3(got, want, 1e-5) {
+		t.Errorf("+1 EV display of 0.25 = %v, want %v", got, want)
+	}
+}
+
+func TestParseToneMapper(t *testing.T) {
+	for _, name := range []string{"linear", "reinhard", "ACES"} {
+		if _, err := ParseToneMapper(name); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := ParseToneMapper("hable"); err == nil {
+		t.Error("ParseToneMapper(\"hable\") did not fail")
+	}
+}
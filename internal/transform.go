@@ -0,0 +1,164 @@
+package internal
+
+// Transform places any Hittable in the world with an affine matrix. Rays are moved into object space for the
+// wrapped object's Hit and the resulting point and normal are moved back into world space.
+type Transform struct {
+	object        Hittable
+	toWorld       Mat4
+	toObject      Mat4
+	normalToWorld Mat4
+	bBox          Aabb
+}
+
+// NewTransform panics if m can not be inverted, e.g. when scaling by zero
+func NewTransform(object Hittable, m Mat4) *Transform {
+	inv, ok := m.Inverse()
+	if !ok {
+		panic("internal: NewTransform with a singular matrix")
+	}
+
+	return &Transform{
+		object:        object,
+		toWorld:       m,
+		toObject:      inv,
+		normalToWorld: inv.Transpose(),
+		bBox:          m.MulAabb(object.GetBounds()),
+	}
+}
+
+func NewTranslate(object Hittable, offset Vec3) *Transform {
+	return NewTransform(object, NewMat4Translate(offset))
+}
+
+func NewRotate(object Hittable, axis Vec3, degrees float32) *Transform {
+	return NewTransform(object, NewMat4Rotate(axis, degrees))
+}
+
+func NewRotateY(object Hittable, degrees float32) *Transform {
+	return NewRotate(object, NewVec3(0, 1, 0), degrees)
+}
+
+func NewScale(object Hittable, s Vec3) *Transform {
+	return NewTransform(object, NewMat4Scale(s))
+}
+
+func (tr *Transform) Hit(r *Ray, rayT Interval) (HitInfo, bool) {
+	// The direction is not normalized so t means the same thing in both spaces
+	objRay := NewRay(tr.toObject.MulPoint(r.origin), tr.toObject.MulDir(r.dir), r.time, r.sampler)
+
+	hi, ok := tr.object.Hit(objRay, rayT)
+	if !ok {
+		return HitInfo{}, false
+	}
+
+	hi.point = tr.toWorld.MulPoint(hi.point)
+	hi.normal = Unit(tr.normalToWorld.MulDir(hi.normal))
+
+	return hi, true
+}
+
+func (tr *Transform) GetBounds() Aabb {
+	return tr.bBox
+}
+
+// TRS is a transform split into a scale, a rotation of Euler angles in degrees and a translation, applied in
+// that order. A zero Scale is treated as no scaling so a TRS can be written with only the parts it needs.
+type TRS struct {
+	Scale     Vec3
+	Rotate    Vec3
+	Translate Vec3
+}
+
+func (t TRS) Mat4() Mat4 {
+	scale := t.Scale
+	if scale.NearZero() {
+		scale = NewVec3(1, 1, 1)
+	}
+	m := NewMat4Scale(scale)
+	m = MulMat4(NewMat4EulerDegrees(t.Rotate), m)
+	return MulMat4(NewMat4Translate(t.Translate), m)
+}
+
+// LerpTRS blends each part of a and b separately, f = 0 is a and f = 1 is b
+func LerpTRS(a, b TRS, f float32) TRS {
+	lerp := func(x, y Vec3) Vec3 {
+		return Add(x, Scale(Sub(y, x), f))
+	}
+	if a.Scale.NearZero() {
+		a.Scale = NewVec3(1, 1, 1)
+	}
+	if b.Scale.NearZero() {
+		b.Scale = NewVec3(1, 1, 1)
+	}
+	return TRS{
+		Scale:     lerp(a.Scale, b.Scale),
+		Rotate:    lerp(a.Rotate, b.Rotate),
+		Translate: lerp(a.Translate, b.Translate),
+	}
+}
+
+// movingTransformBoundSteps is how many times along the motion the bounds of a MovingTransform are sampled
+const movingTransformBoundSteps = 32
+
+// MovingTransform animates a Hittable from one TRS at time0 to another at time1, holding still outside that
+// interval. Each ray sees the object where it was at the ray's time.
+type MovingTransform struct {
+	object Hittable
+	from   TRS
+	to     TRS
+	time0  float32
+	time1  float32
+	bBox   Aabb
+}
+
+func NewMovingTransform(object Hittable, from, to TRS, time0, time1 float32) *MovingTransform {
+	mt := &MovingTransform{
+		object: object,
+		from:   from,
+		to:     to,
+		time0:  time0,
+		time1:  time1,
+	}
+
+	// Rotating corners sweep arcs, so the swept bounds are the union of the bounds at many points of the motion
+	objBounds := object.GetBounds()
+	mt.bBox = from.Mat4().MulAabb(objBounds)
+	for i := 1; i <= movingTransformBoundSteps; i++ {
+		f := float32(i) / movingTransformBoundSteps
+		mt.bBox = NewAabbFromBoxes(mt.bBox, LerpTRS(from, to, f).Mat4().MulAabb(objBounds))
+	}
+
+	return mt
+}
+
+// At is the placement of the object at time t
+func (mt *MovingTransform) At(t float32) TRS {
+	if mt.time1 == mt.time0 {
+		return mt.from
+	}
+	return LerpTRS(mt.from, mt.to, Clamp(0, 1, (t-mt.time0)/(mt.time1-mt.time0)))
+}
+
+func (mt *MovingTransform) Hit(r *Ray, rayT Interval) (HitInfo, bool) {
+	toWorld := mt.At(r.time).Mat4()
+	toObject, ok := toWorld.Inverse()
+	if !ok {
+		return HitInfo{}, false
+	}
+
+	objRay := NewRay(toObject.MulPoint(r.origin), toObject.MulDir(r.dir), r.time, r.sampler)
+
+	hi, ok := mt.object.Hit(objRay, rayT)
+	if !ok {
+		return HitInfo{}, false
+	}
+
+	hi.point = toWorld.MulPoint(hi.point)
+	hi.normal = Unit(toObject.Transpose().MulDir(hi.normal))
+
+	return hi, true
+}
+
+func (mt *MovingTransform) GetBounds() Aabb {
+	return mt.bBox
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+// TestTransformHit hits a unit sphere stretched to twice its length along x, then turned a quarter around y
+// and moved away. It is an ellipsoid around (0, 0, -10) reaching 1 along x and y and 2 along z.
+func TestTransformHit(t *testing.T) {
+	mat := NewLambertian(NewSolidColor(1, 1, 1))
+	m := TRS{
+		Scale:     NewVec3(2, 1, 1),
+		Rotate:    NewVec3(0, 90, 0),
+		Translate: NewVec3(0, 0, -10),
+	}.Mat4()
+	tr := NewTransform(NewSphere(NewVec3Zero(), 1, &mat), m)
+
+	sqrt3_4 := float32(math.Sqrt(0.75))
+	tests := []struct {
+		name   string
+		ray    *Ray
+		t      float32
+		point  Vec3
+		normal Vec3
+	}{
+		{
+			"tip of the long axis",
+			NewRay(NewVec3(0, 0, 0), NewVec3(0, 0, -1), 0, nil),
+			8, NewVec3(0, 0, -8), NewVec3(0, 0, 1),
+		},
+		{
+			// On the ellipsoid x² + y² + z²/4 = 1 the normal follows the gradient (x, y, z/4), not the
+			// stretched normal of the sphere
+			"side, off centre along the long axis",
+			NewRay(NewVec3(5, 0, -9), NewVec3(-1, 0, 0), 0, nil),
+			5 - sqrt3_4, NewVec3(sqrt3_4, 0, -9), Unit(NewVec3(sqrt3_4, 0, 0.25)),
+		},
+		{
+			// t is measured along the unnormalized world space direction
+			"long direction",
+			NewRay(NewVec3(0, 0, 0), NewVec3(0, 0, -4), 0, nil),
+			2, NewVec3(0, 0, -8), NewVec3(0, 0, 1),
+		},
+	}
+	for _, tt := range tests {
+		hi, ok := tr.Hit(tt.ray, unbounded)
+		if !ok {
+			t.Errorf("%s: missed", tt.name)
+			continue
+		}
+		if !approxEqual(hi.t, tt.t, 1e-4) {
+			t.Errorf("%s: t = %v, want %v", tt.name, hi.t, tt.t)
+		}
+		if !approxEqualVec3(hi.point, tt.point, 1e-4) {
+			t.Errorf("%s: hit point %v, want %v", tt.name, hi.point, tt.point)
+		}
+		if !approxEqualVec3(hi.normal, tt.normal, 1e-4) {
+			t.Errorf("%s: normal %v, want %v", tt.name, hi.normal, tt.normal)
+		}
+	}
+
+	// Just in front of the tip of the long axis
+	if _, ok := tr.Hit(NewRay(NewVec3(0, 0, -7.9), NewVec3(1, 0, 0), 0, nil), unbounded); ok {
+		t.Error("ray passing in front of the tip hit the ellipsoid")
+	}
+}
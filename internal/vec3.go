@@ -159,12 +159,6 @@ func (vec Vec3) GetTexture(u, v, point Vec3) Color {
 	return v
 }
 
-func (v *Vec3) ToGamma2() {
-	v.X = float32(math.Sqrt(float64(v.X)))
-	v.Y = float32(math.Sqrt(float64(v.Y)))
-	v.Z = float32(math.Sqrt(float64(v.Z)))
-}
-
 const nearZeroEpsilon float32 = 1e-8
 
 func (v *Vec3) NearZero() bool {
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+func TestReflect(t *testing.T) {
+	tests := []struct {
+		name string
+		v    Vec3
+		n    Vec3
+		want Vec3
+	}{
+		{"head on", NewVec3(0, -1, 0), NewVec3(0, 1, 0), NewVec3(0, 1, 0)},
+		{"45 degrees", NewVec3(1, -1, 0), NewVec3(0, 1, 0), NewVec3(1, 1, 0)},
+		{"grazing", NewVec3(1, 0, 0), NewVec3(0, 1, 0), NewVec3(1, 0, 0)},
+		{"tilted normal", NewVec3(0, -1, 0), Unit(NewVec3(1, 1, 0)), NewVec3(1, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reflect(tt.v, tt.n); !approxEqualVec3(got, tt.want, 1e-5) {
+				t.Errorf("reflect(%v, %v) = %v, want %v", tt.v, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefract(t *testing.T) {
+	n := NewVec3(0, 1, 0)
+
+	t.Run("matched indices pass straight through", func(t *testing.T) {
+		uv := Unit(NewVec3(1, -2, 0.5))
+		if got := refract(uv, n, 1); !approxEqualVec3(got, uv, 1e-5) {
+			t.Errorf("refract = %v, want %v", got, uv)
+		}
+	})
+
+	t.Run("head on is not bent", func(t *testing.T) {
+		uv := NewVec3(0, -1, 0)
+		if got := refract(uv, n, 1/1.5); !approxEqualVec3(got, uv, 1e-5) {
+			t.Errorf("refract = %v, want %v", got, uv)
+		}
+	})
+
+	// Snell's law: eta sin(theta) = eta' sin(theta')
+	for _, degrees := range []float64{10, 30, 45, 60, 80} {
+		for _, eta := range []float32{1 / 1.5, 1 / 1.33, 1.2} {
+			theta := degrees * math.Pi / 180
+			sinThetaPrime := float64(eta) * math.Sin(theta)
+			if sinThetaPrime > 1 {
+				continue
+			}
+
+			uv := NewVec3(float32(math.Sin(theta)), -float32(math.Cos(theta)), 0)
+			got := refract(uv, n, eta)
+
+			if l := got.Len(); !approxEqual(l, 1, 1e-4) {
+				t.Errorf("%v degrees, eta %v: refracted direction has length %v, want 1", degrees, eta, l)
+			}
+			if !approxEqual(got.X, float32(sinThetaPrime), 1e-4) || got.Y >= 0 || got.Z != 0 {
+				t.Errorf("%v degrees, eta %v: refract = %v, want sin(theta') %v going down in the same plane",
+					degrees, eta, got, sinThetaPrime)
+			}
+		}
+	}
+}
@@ -1,289 +1,365 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"flag"
 	"fmt"
-	"math/rand"
 	"os"
+	"path/filepath"
 	"raytracer/internal"
 	"runtime/pprof"
+	"strings"
 	"time"
 )
 
-const profileEnabled = true
-const (
-	randSphereScene      = 0
-	earthScene           = 1
-	perlinDemoScene      = 2
-	quadDemoScene        = 3
-	simpleLightDemoScene = 4
-	cornellBoxDemoScene  = 5
-)
-
-func main() {
-	now := time.Now()
+type options struct {
+	list        bool
+	scene       string
+	sceneFile   string
+	env         string
+	envRotate   float64
+	envScale    float64
+	sky         bool
+	sunElev     float64
+	sunAzimuth  float64
+	turbidity   float64
+	bvh         string
+	bvhStats    bool
+	flatten     bool
+	out         string
+	width       int
+	samples     int
+	depth       int
+	tileSize    int
+	workers     int
+	timeout     time.Duration
+	partial     bool
+	cpuProfile  string
+	memProfile  string
+	seed        int64
+	seedSet     bool
+	aovs        string
+	denoise     bool
+	exposure    float64
+	exposureSet bool
+	toneMap     string
+	adaptive    float64
+	minSamples  int
+	sampler     string
+}
 
-	var cpuPprofF *os.File
-	var MemPprofF *os.File
-	var pprofErr error
-	if profileEnabled {
-		cpuPprofF, pprofErr = internal.Overwrite("out/cpu.pprof")
-		if pprofErr != nil {
-			panic(pprofErr)
+func parseFlags() options {
+	var o options
+	flag.BoolVar(&o.list, "list", false, "list the built-in scenes and exit")
+	flag.StringVar(&o.scene, "scene", "cornellBox", "built-in scene to render")
+	flag.StringVar(&o.sceneFile, "scene-file", "", "JSON scene file to render instead of a built-in scene")
+	flag.StringVar(&o.env, "env", "", "equirectangular .hdr or .pfm image lighting the scene instead of its background")
+	flag.Float64Var(&o.envRotate, "env-rotate", 0, "degrees to turn the -env image around the up axis")
+	flag.Float64Var(&o.envScale, "env-intensity", 1, "brightness multiplier for the -env image")
+	flag.BoolVar(&o.sky, "sky", false, "light the scene with a procedural daylight sky and sun instead of its background")
+	flag.Float64Var(&o.sunElev, "sun-elevation", 45, "degrees the -sky sun is above the horizon")
+	flag.Float64Var(&o.sunAzimuth, "sun-azimuth", 0, "degrees the -sky sun is turned around the up axis")
+	flag.Float64Var(&o.turbidity, "turbidity", 2.5, "haziness of the -sky air, from 2 for clear to 10 for hazy")
+	flag.StringVar(&o.bvh, "bvh", "median", "BVH builder, median or sah")
+	flag.BoolVar(&o.bvhStats, "bvh-stats", false, "print the estimated traversal cost of every BVH builder for the scene")
+	flag.BoolVar(&o.flatten, "flatten", true, "compile the BVH into a flat, cache friendly layout for traversal")
+	flag.StringVar(&o.out, "out", "out/img.png", "output image; the extension picks the format (.png, .ppm, .p6.ppm, .pfm, .hdr)")
+	flag.IntVar(&o.width, "width", 0, "image width in pixels, 0 keeps the scene default")
+	flag.IntVar(&o.samples, "spp", 0, "samples per pixel, 0 keeps the scene default")
+	flag.IntVar(&o.depth, "depth", 0, "max ray bounce depth, 0 keeps the scene default")
+	flag.IntVar(&o.tileSize, "tile", 0, "tile size in pixels, 0 keeps the default")
+	flag.IntVar(&o.workers, "workers", 0, "number of render workers, 0 uses every CPU")
+	flag.DurationVar(&o.timeout, "timeout", 0, "stop rendering after this long, 0 means no limit")
+	flag.BoolVar(&o.partial, "partial", false, "write the unfinished image when the timeout is hit")
+	flag.StringVar(&o.cpuProfile, "cpuprofile", "", "write a CPU profile to this file")
+	flag.StringVar(&o.memProfile, "memprofile", "", "write a heap profile to this file")
+	flag.Int64Var(&o.seed, "seed", 0, "seed for the scene and the camera samples; a scene file keeps its own seed unless this is set")
+	flag.StringVar(&o.aovs, "aovs", "", "comma separated AOVs (normal, depth, albedo, id, samples) written next to -out, e.g. out/img.normal.png")
+	flag.BoolVar(&o.denoise, "denoise", false, "filter the sampling noise out of the image, guided by the normal, depth and albedo AOVs")
+	flag.Float64Var(&o.exposure, "exposure", 0, "exposure in EV, each step doubles the brightness; a scene keeps its own unless this is set")
+	flag.StringVar(&o.toneMap, "tonemap", "", "tone mapper for bright highlights: linear, reinhard or aces; empty keeps the scene default")
+	flag.Float64Var(&o.adaptive, "adaptive", 0, "stop sampling pixels whose relative error is below this, e.g. 0.05; -spp becomes the maximum and 0 disables it")
+	flag.IntVar(&o.minSamples, "min-spp", 16, "samples every pixel takes, and the batch size after that, with -adaptive")
+	flag.StringVar(&o.sampler, "sampler", "", "sampler placing the samples of every pixel: independent, stratified, halton or sobol; empty keeps the scene default")
+	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "seed":
+			o.seedSet = true
+		case "exposure":
+			o.exposureSet = true
 		}
-		defer cpuPprofF.Close()
+	})
+	return o
+}
 
-		MemPprofF, pprofErr = internal.Overwrite("out/mem.pprof")
-		if pprofErr != nil {
-			panic(pprofErr)
+// parseAOVs reads the -aovs list
+func (o options) parseAOVs() ([]internal.AOV, error) {
+	var aovs []internal.AOV
+	for _, name := range strings.Split(o.aovs, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
 		}
-		defer MemPprofF.Close()
-
+		aov, err := internal.ParseAOV(name)
+		if err != nil {
+			return nil, err
+		}
+		aovs = append(aovs, aov)
 	}
+	return aovs, nil
+}
 
-	f, err := internal.Overwrite("out/img.ppm")
-	if err != nil {
-		panic(err)
+// cameraOverrides turns the command line flags that were set into camera options
+func (o options) cameraOverrides(encoder internal.ImageEncoder, aovs []internal.AOV) []internal.CameraOpt {
+	opts := []internal.CameraOpt{
+		internal.WithImageEncoder(encoder),
+		internal.WithProgress(printProgress),
+		internal.WithPartialOutput(o.partial),
 	}
-	defer f.Close()
-
-	if err != nil {
-		panic(err)
-	}
-	if profileEnabled {
-		pprof.StartCPUProfile(cpuPprofF)
-	}
-	scene := cornellBoxDemoScene
-	switch scene {
-	case randSphereScene:
-		err = randSpheres(f)
-	case earthScene:
-		err = earth(f)
-	case perlinDemoScene:
-		err = perlinDemo(f)
-	case quadDemoScene:
-		err = quadDemo(f)
-	case simpleLightDemoScene:
-		err = simpleLightDemo(f)
-	case cornellBoxDemoScene:
-		err = cornellBox(f)
-	}
-	if profileEnabled {
-		pprof.StopCPUProfile()
-		pprof.WriteHeapProfile(MemPprofF)
+	if o.width > 0 {
+		opts = append(opts, internal.WithImageWidth(o.width))
 	}
-	if err != nil {
-		panic(err)
+	if o.samples > 0 {
+		opts = append(opts, internal.WithSamplesPerPixel(o.samples))
 	}
-	fmt.Println("Finished in: " + time.Since(now).String())
+	if o.depth > 0 {
+		opts = append(opts, internal.WithMaxRayDepth(o.depth))
+	}
+	if o.tileSize > 0 {
+		opts = append(opts, internal.WithTileSize(o.tileSize))
+	}
+	if o.workers > 0 {
+		opts = append(opts, internal.WithWorkers(o.workers))
+	}
+	if o.seedSet {
+		opts = append(opts, internal.WithSeed(o.seed))
+	}
+	if len(aovs) > 0 {
+		opts = append(opts, internal.WithAOVs(aovs...))
+	}
+	if o.denoise {
+		opts = append(opts, internal.WithDenoiser(internal.NewDenoiser()))
+	}
+	if o.exposureSet {
+		opts = append(opts, internal.WithExposure(float32(o.exposure)))
+	}
+	if o.adaptive > 0 {
+		opts = append(opts, internal.WithAdaptiveSampling(o.minSamples, float32(o.adaptive)))
+	}
+	return opts
 }
 
-func earth(f *os.File) error {
-	camera := internal.NewCamera(
-		16.0/9.0,
-		400.0,
-		internal.WithSamplesPerPixel(100),
-		internal.WithMaxRayDepth(50),
-		internal.WithLookFrom(internal.NewVec3(0, 0, 12)),
-		internal.WithLookAt(internal.NewVec3(0, 0, 0)),
-		internal.WithFOVDegrees(20),
-		internal.WithDefocusAngleDegrees(0),
-		internal.WithBackgroundColor(internal.NewVec3(0.7, 0.8, 1)),
-	)
-	world := internal.NewWorld()
-
-	earthImg, err := internal.LoadJPEG("textures/earthmap.jpg")
+// buildScene loads the scene file if one was given, otherwise the selected built-in scene. -env and -sky are
+// mutually exclusive.
+func (o options) buildScene(encoder internal.ImageEncoder) (*internal.Camera, *internal.World, error) {
+	if o.env != "" && o.sky {
+		return nil, nil, fmt.Errorf("-env and -sky both replace the background, pick one")
+	}
+	aovs, err := o.parseAOVs()
 	if err != nil {
-		panic(err)
+		return nil, nil, err
+	}
+	overrides := o.cameraOverrides(encoder, aovs)
+	if o.toneMap != "" {
+		tm, err := internal.ParseToneMapper(o.toneMap)
+		if err != nil {
+			return nil, nil, err
+		}
+		overrides = append(overrides, internal.WithToneMapper(tm))
+	}
+	if o.sampler != "" {
+		kind, err := internal.ParseSampler(o.sampler)
+		if err != nil {
+			return nil, nil, err
+		}
+		overrides = append(overrides, internal.WithSampler(kind))
+	}
+	if o.env != "" {
+		img, err := internal.LoadHDRImage(o.env)
+		if err != nil {
+			return nil, nil, err
+		}
+		env := internal.NewEnvironmentMap(img,
+			internal.WithEnvironmentRotation(float32(o.envRotate)),
+			internal.WithEnvironmentIntensity(float32(o.envScale)),
+		)
+		overrides = append(overrides, internal.WithEnvironment(env))
+	}
+	if o.sky {
+		sky := internal.NewSky(
+			internal.WithSunElevation(float32(o.sunElev)),
+			internal.WithSunAzimuth(float32(o.sunAzimuth)),
+			internal.WithTurbidity(float32(o.turbidity)),
+		)
+		overrides = append(overrides, internal.WithEnvironment(sky))
 	}
-	earthTex := internal.NewImageTexture(earthImg)
-	mat := internal.NewLambertian(&earthTex)
-	world.Add(internal.NewSphere(internal.NewVec3(0, 0, 0), 2, &mat))
-
-	worldTree := internal.NewBVHFromWorld(world)
-	return camera.Render(worldTree, f)
-}
-
-func perlinDemo(f *os.File) error {
-	camera := internal.NewCamera(
-		16.0/9.0,
-		400.0,
-		internal.WithSamplesPerPixel(100),
-		internal.WithMaxRayDepth(50),
-		internal.WithLookFrom(internal.NewVec3(13, 2, 3)),
-		internal.WithLookAt(internal.NewVec3(0, 0, 0)),
-		internal.WithFOVDegrees(20),
-		internal.WithDefocusAngleDegrees(0),
-		internal.WithBackgroundColor(internal.NewVec3(0.7, 0.8, 1)),
-	)
-	world := internal.NewWorld()
-
-	src := rand.NewSource(time.Now().Unix())
-	randCtx := rand.New(src)
 
-	perlinTex := internal.NewNoiseTexture(randCtx, 4)
-	mat := internal.NewLambertian(&perlinTex)
-	world.Add(internal.NewSphere(internal.NewVec3(0, -1000, 0), 1000, &mat))
-	world.Add(internal.NewSphere(internal.NewVec3(0, 2, 0), 2, &mat))
+	if o.sceneFile != "" {
+		return internal.LoadScene(o.sceneFile, overrides...)
+	}
 
-	worldTree := internal.NewBVHFromWorld(world)
-	return camera.Render(worldTree, f)
+	s, ok := findScene(o.scene)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown scene %q, use -list to see the available scenes", o.scene)
+	}
+	return s.build(o.seed, overrides...)
 }
 
-func quadDemo(f *os.File) error {
-	camera := internal.NewCamera(
-		16.0/9.0,
-		400.0,
-		internal.WithSamplesPerPixel(100),
-		internal.WithMaxRayDepth(50),
-		internal.WithLookFrom(internal.NewVec3(0, 0, 9)),
-		internal.WithLookAt(internal.NewVec3(0, 0, 0)),
-		internal.WithFOVDegrees(80),
-		internal.WithDefocusAngleDegrees(0),
-		internal.WithBackgroundColor(internal.NewVec3(0.7, 0.8, 1)),
-	)
-	world := internal.NewWorld()
-
-	leftRed := internal.NewLambertian(internal.NewSolidColor(1, 0.2, 0.2))
-	backGreen := internal.NewLambertian(internal.NewSolidColor(0.2, 1, 0.2))
-	rightBlue := internal.NewLambertian(internal.NewSolidColor(0.2, 0.2, 1))
-	upperOrange := internal.NewLambertian(internal.NewSolidColor(1, 0.5, 0))
-	lowerTeal := internal.NewLambertian(internal.NewSolidColor(0.2, 0.8, 0.8))
+func main() {
+	o := parseFlags()
 
-	world.Add(internal.NewQuad(internal.NewVec3(-3, -2, 5), internal.NewVec3(0, 0, -4), internal.NewVec3(0, 4, 0), &leftRed))
-	world.Add(internal.NewQuad(internal.NewVec3(-2, -2, 0), internal.NewVec3(4, 0, 0), internal.NewVec3(0, 4, 0), &backGreen))
-	world.Add(internal.NewQuad(internal.NewVec3(3, -2, 1), internal.NewVec3(0, 0, 4), internal.NewVec3(0, 4, 0), &rightBlue))
-	world.Add(internal.NewQuad(internal.NewVec3(-2, 3, 1), internal.NewVec3(4, 0, 0), internal.NewVec3(0, 0, 4), &upperOrange))
-	world.Add(internal.NewQuad(internal.NewVec3(-2, -3, 5), internal.NewVec3(4, 0, 0), internal.NewVec3(0, 0, -4), &lowerTeal))
+	if o.list {
+		for _, s := range scenes {
+			if missing := s.missingAssets(); len(missing) > 0 {
+				fmt.Printf("%s (missing %s)\n", s.name, strings.Join(missing, ", "))
+				continue
+			}
+			fmt.Println(s.name)
+		}
+		return
+	}
 
-	worldTree := internal.NewBVHFromWorld(world)
-	return camera.Render(worldTree, f)
+	if err := run(o); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
-func simpleLightDemo(f *os.File) error {
-	camera := internal.NewCamera(
-		16.0/9.0,
-		400.0,
-		internal.WithSamplesPerPixel(500),
-		internal.WithMaxRayDepth(50),
-		internal.WithLookFrom(internal.NewVec3(26, 3, 6)),
-		internal.WithLookAt(internal.NewVec3(0, 2, 0)),
-		internal.WithFOVDegrees(20),
-		internal.WithDefocusAngleDegrees(0),
-		internal.WithBackgroundColor(internal.NewVec3Zero()),
-	)
-	world := internal.NewWorld()
+func run(o options) error {
+	now := time.Now()
 
-	src := rand.NewSource(time.Now().Unix())
-	randCtx := rand.New(src)
+	encoder, err := internal.NewImageEncoderFromFile(o.out)
+	if err != nil {
+		return err
+	}
 
-	perlinTex := internal.NewNoiseTexture(randCtx, 4)
-	mat := internal.NewLambertian(&perlinTex)
-	world.Add(internal.NewSphere(internal.NewVec3(0, -1000, 0), 1000, &mat))
-	world.Add(internal.NewSphere(internal.NewVec3(0, 2, 0), 2, &mat))
+	camera, world, err := o.buildScene(encoder)
+	if err != nil {
+		return err
+	}
 
-	red := internal.NewLambertian(internal.NewSolidColor(1, 0, 0))
-	world.Add(internal.NewSphere(internal.NewVec3(-4, 2, 4), 2, &red))
+	// For the material ID AOV, in the order of the scene, which the BVH does not keep
+	world.NumberMaterials()
 
-	diffLight := internal.NewDiffuseLight(internal.NewSolidColor(4, 4, 4))
-	world.Add(internal.NewSphere(internal.NewVec3(0, 7, 0), 2, &diffLight))
+	if o.bvhStats {
+		printBVHStats(world)
+	}
+	bvh, err := buildBVH(o.bvh, world)
+	if err != nil {
+		return err
+	}
+	var tree internal.Hittable = bvh
+	if o.flatten {
+		tree = internal.NewLinearBVH(bvh)
+	}
 
-	worldTree := internal.NewBVHFromWorld(world)
-	return camera.Render(worldTree, f)
-}
+	if err = os.MkdirAll(filepath.Dir(o.out), 0o755); err != nil {
+		return err
+	}
 
-func cornellBox(f *os.File) error {
-	camera := internal.NewCamera(
-		1,
-		600.0,
-		internal.WithSamplesPerPixel(200),
-		internal.WithMaxRayDepth(50),
-		internal.WithLookFrom(internal.NewVec3(278, 278, -800)),
-		internal.WithLookAt(internal.NewVec3(278, 278, 0)),
-		internal.WithFOVDegrees(40),
-		internal.WithDefocusAngleDegrees(0),
-		internal.WithBackgroundColor(internal.NewVec3Zero()),
-	)
-	world := internal.NewWorld()
+	if o.cpuProfile != "" {
+		cpuPprofF, err := internal.Overwrite(o.cpuProfile)
+		if err != nil {
+			return err
+		}
+		defer cpuPprofF.Close()
 
-	red := internal.NewLambertian(internal.NewSolidColor(.65, .05, .05))
-	white := internal.NewLambertian(internal.NewSolidColor(.73, .73, .73))
-	green := internal.NewLambertian(internal.NewSolidColor(.12, .45, .15))
-	light := internal.NewDiffuseLight(internal.NewSolidColor(15, 15, 15))
+		if err = pprof.StartCPUProfile(cpuPprofF); err != nil {
+			return err
+		}
+	}
 
-	world.Add(internal.NewQuad(internal.NewVec3(555, 0, 0), internal.NewVec3(0, 555, 0), internal.NewVec3(0, 0, 555), &green))
-	world.Add(internal.NewQuad(internal.NewVec3(0, 0, 0), internal.NewVec3(0, 555, 0), internal.NewVec3(0, 0, 555), &red))
-	world.Add(internal.NewQuad(internal.NewVec3(343, 554, 332), internal.NewVec3(-130, 0, 0), internal.NewVec3(0, 0, -105), &light))
-	world.Add(internal.NewQuad(internal.NewVec3(0, 0, 0), internal.NewVec3(555, 0, 0), internal.NewVec3(0, 0, 555), &white))
-	world.Add(internal.NewQuad(internal.NewVec3(555, 555, 555), internal.NewVec3(-555, 0, 0), internal.NewVec3(0, 0, -555), &white))
-	world.Add(internal.NewQuad(internal.NewVec3(0, 0, 555), internal.NewVec3(555, 0, 0), internal.NewVec3(0, 555, 0), &white))
+	ctx := context.Background()
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
 
-	world.Add(internal.Box(internal.NewVec3(130, 0, 65), internal.NewVec3(295, 165, 230), &white)...)
-	world.Add(internal.Box(internal.NewVec3(265, 0, 295), internal.NewVec3(430, 330, 460), &white)...)
+	// The image is kept in memory until the render is over, so a failed or cancelled render leaves the previous
+	// image alone. Something is only encoded when the render finished or -partial asked for the unfinished one.
+	var img bytes.Buffer
+	err = camera.RenderContext(ctx, tree, &img)
+	fmt.Println()
+	if img.Len() > 0 {
+		if writeErr := writeFile(o.out, img.Bytes()); writeErr != nil {
+			return writeErr
+		}
+	}
 
-	worldTree := internal.NewBVHFromWorld(world)
-	return camera.Render(worldTree, f)
-}
+	if o.cpuProfile != "" {
+		pprof.StopCPUProfile()
+	}
+	if o.memProfile != "" {
+		memPprofF, memErr := internal.Overwrite(o.memProfile)
+		if memErr != nil {
+			return memErr
+		}
+		defer memPprofF.Close()
 
-func randSpheres(f *os.File) error {
-	camera := internal.NewCamera(
-		16.0/9.0,
-		400.0,
-		internal.WithSamplesPerPixel(500),
-		internal.WithMaxRayDepth(50),
-		internal.WithLookFrom(internal.NewVec3(13, 2, 3)),
-		internal.WithLookAt(internal.NewVec3(0, 0, 0)),
-		internal.WithFOVDegrees(20),
-		internal.WithDefocusAngleDegrees(0.6),
-		internal.WithFocusDist(10),
-		internal.WithBackgroundColor(internal.NewVec3(0.7, 0.8, 1)),
-	)
-	world := internal.NewWorld()
+		if memErr = pprof.WriteHeapProfile(memPprofF); memErr != nil {
+			return memErr
+		}
+	}
 
-	checkered := internal.NewCheckered(0.32, internal.NewVec3(0.2, 0.3, 0.1), internal.NewVec3(0.9, 0.9, 0.9))
-	matGround := internal.NewLambertian(&checkered)
-	world.Add(internal.NewSphere(internal.NewVec3(0, -1000, 0), 1000, &matGround))
+	if err != nil {
+		return err
+	}
+	if err = camera.WriteAOVs(o.out); err != nil {
+		return err
+	}
+	fmt.Println("Finished in: " + time.Since(now).String())
+	return nil
+}
 
-	src := rand.NewSource(time.Now().Unix())
-	randCtx := rand.New(src)
-	p := internal.NewVec3(4, 0.2, 0)
-	for i := -11; i < 11; i++ {
-		for j := -11; j < 11; j++ {
-			matPer := rand.Float32()
-			center := internal.NewVec3(float32(i)+0.9*rand.Float32(), 0.2, float32(j)+0.9*rand.Float32())
+// writeFile replaces fname with data
+func writeFile(fname string, data []byte) error {
+	f, err := internal.Overwrite(fname)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
 
-			dist := internal.Sub(center, p)
-			ln := dist.Len()
-			if ln > 0.9 {
-				var sphereMat internal.Material
-				if matPer < 0.8 {
-					randCol := internal.Mul(internal.NewVec3Rand32(randCtx), internal.NewVec3Rand32(randCtx))
-					tex := internal.NewSolidColor(randCol.X, randCol.Y, randCol.Z)
-					mat := internal.NewLambertian(tex)
-					sphereMat = &mat
-				} else if matPer < 0.95 {
-					albedo := internal.NewVec3RandRange32(randCtx, 0.5, 1)
-					fuzz := internal.RandF32N(randCtx, 0, 0.5)
-					mat := internal.NewMetal(albedo, fuzz)
-					sphereMat = &mat
-				} else {
-					mat := internal.NewDielectric(1.5)
-					sphereMat = &mat
-				}
-				world.Add(internal.NewSphere(center, 0.2, sphereMat))
-			}
+var bvhBuilders = map[string]func(*internal.World) *internal.BVH{
+	"median": internal.NewBVHFromWorld,
+	"sah": func(w *internal.World) *internal.BVH {
+		return internal.NewSAHBVHFromWorld(w)
+	},
+}
 
-		}
+func buildBVH(name string, world *internal.World) (*internal.BVH, error) {
+	build, ok := bvhBuilders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown bvh builder %q", name)
 	}
+	return build(world), nil
+}
 
-	m1 := internal.NewDielectric(1.5)
-	world.Add(internal.NewSphere(internal.NewVec3(0, 1, 0), 1, &m1))
+func printBVHStats(world *internal.World) {
+	for _, name := range []string{"median", "sah"} {
+		start := time.Now()
+		tree, _ := buildBVH(name, world)
+		built := time.Since(start)
 
-	m2 := internal.NewLambertian(internal.NewSolidColor(0.4, 0.2, 0.1))
-	world.Add(internal.NewSphere(internal.NewVec3(-4, 1, 0), 1, &m2))
+		stats := internal.GetBVHStats(tree, 1, 1)
+		fmt.Printf("%-6s cost %8.2f  nodes %6d  leaves %6d  max depth %3d  built in %s\n",
+			name, stats.Cost, stats.Nodes, stats.Leaves, stats.MaxDepth, built)
+	}
+}
 
-	m3 := internal.NewMetal(internal.NewVec3(0.7, 0.6, 0.5), 0)
-	world.Add(internal.NewSphere(internal.NewVec3(4, 1, 0), 1, &m3))
+const progressBarWidth = 40
 
-	worldTree := internal.NewBVHFromWorld(world)
-	return camera.Render(worldTree, f)
+// printProgress redraws a single line progress bar on stdout
+func printProgress(p internal.Progress) {
+	filled := int(p.Fraction() * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	fmt.Printf("\r[%s] %5.1f%% %6.1f spp elapsed %s eta %s   ", bar, 100*p.Fraction(), p.SamplesPerPixel(),
+		p.Elapsed.Round(time.Second), p.ETA.Round(time.Second))
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"raytracer/internal"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden images of the scene tests")
+
+const (
+	goldenDir    = "testdata/golden"
+	failedDir    = "testdata/failed"
+	goldenSeed   = 1
+	goldenWidth  = 64
+	goldenSPP    = 32
+	goldenDepth  = 10
+	goldenBlock  = 8
+	goldenMaxErr = 0.015
+)
+
+// TestScenes renders every built-in scene small and compares it to its golden image. The comparison is the
+// RMSE of the two images averaged over goldenBlock pixel squares, which ignores sampling noise that moves
+// between platforms but not a change in the lighting or the geometry. Failures write the render and a diff
+// image to testdata/failed. Run with -update to accept the current renders.
+func TestScenes(t *testing.T) {
+	for _, s := range scenes {
+		s := s
+		t.Run(s.name, func(t *testing.T) {
+			got, err := renderGolden(s)
+			if errors.Is(err, fs.ErrNotExist) {
+				t.Skipf("scene assets are missing: %v", err)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenPath := filepath.Join(goldenDir, s.name+".png")
+			if *update {
+				if err = writePNG(goldenPath, got); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := readPNG(goldenPath)
+			if err != nil {
+				t.Fatalf("%v, run the tests with -update to create it", err)
+			}
+			if !got.Bounds().Eq(want.Bounds()) {
+				t.Fatalf("rendered %v, golden image is %v", got.Bounds(), want.Bounds())
+			}
+
+			if rmse := blockRMSE(got, want, goldenBlock); rmse > goldenMaxErr {
+				gotPath := filepath.Join(failedDir, s.name+".png")
+				diffPath := filepath.Join(failedDir, s.name+".diff.png")
+				if err = writePNG(gotPath, got); err != nil {
+					t.Log(err)
+				}
+				if err = writePNG(diffPath, diffImage(got, want)); err != nil {
+					t.Log(err)
+				}
+				t.Errorf("differs from %s by %.4f RMSE, over the %.4f tolerance; see %s and %s",
+					goldenPath, rmse, goldenMaxErr, gotPath, diffPath)
+			}
+		})
+	}
+}
+
+func renderGolden(s scene) (*image.RGBA, error) {
+	camera, world, err := s.build(goldenSeed,
+		internal.WithImageWidth(goldenWidth),
+		internal.WithSamplesPerPixel(goldenSPP),
+		internal.WithMaxRayDepth(goldenDepth),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tree := internal.NewLinearBVH(internal.NewBVHFromWorld(world))
+	return camera.RenderFramebuffer(tree).ToRGBA(), nil
+}
+
+// blockRMSE is the root mean square difference of the average colors of every block by block square, with
+// channels from 0 to 1
+func blockRMSE(a, b *image.RGBA, block int) float64 {
+	bounds := a.Bounds()
+	sum := 0.0
+	n := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += block {
+		for x := bounds.Min.X; x < bounds.Max.X; x += block {
+			r := image.Rect(x, y, x+block, y+block).Intersect(bounds)
+			ma := blockMean(a, r)
+			mb := blockMean(b, r)
+			for c := range ma {
+				d := ma[c] - mb[c]
+				sum += d * d
+				n++
+			}
+		}
+	}
+	return math.Sqrt(sum / float64(n))
+}
+
+func blockMean(img *image.RGBA, r image.Rectangle) [3]float64 {
+	var mean [3]float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			p := img.RGBAAt(x, y)
+			mean[0] += float64(p.R)
+			mean[1] += float64(p.G)
+			mean[2] += float64(p.B)
+		}
+	}
+	pixels := float64(r.Dx() * r.Dy() * 255)
+	for c := range mean {
+		mean[c] /= pixels
+	}
+	return mean
+}
+
+// diffImage shows the absolute difference of every pixel, brightened four times so small changes show up
+func diffImage(a, b *image.RGBA) *image.RGBA {
+	diff := image.NewRGBA(a.Bounds())
+	absDiff := func(x, y uint8) uint8 {
+		d := int(x) - int(y)
+		if d < 0 {
+			d = -d
+		}
+		return uint8(min(4*d, 255))
+	}
+	for y := a.Bounds().Min.Y; y < a.Bounds().Max.Y; y++ {
+		for x := a.Bounds().Min.X; x < a.Bounds().Max.X; x++ {
+			pa := a.RGBAAt(x, y)
+			pb := b.RGBAAt(x, y)
+			diff.SetRGBA(x, y, color.RGBA{R: absDiff(pa.R, pb.R), G: absDiff(pa.G, pb.G), B: absDiff(pa.B, pb.B), A: 255})
+		}
+	}
+	return diff
+}
+
+func readPNG(fname string) (*image.RGBA, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			rgba.Set(x, y, img.At(x, y))
+		}
+	}
+	return rgba, nil
+}
+
+func writePNG(fname string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(fname), 0o755); err != nil {
+		return err
+	}
+	f, err := internal.Overwrite(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, img)
+}
+
+func TestBuildSceneRejectsEnvAndSky(t *testing.T) {
+	o := options{scene: "cornellBox", env: "sky.hdr", sky: true}
+	_, _, err := o.buildScene(nil)
+	if err == nil || !strings.Contains(err.Error(), "-env and -sky") {
+		t.Errorf("error %v, want one saying -env and -sky cannot be combined", err)
+	}
+}
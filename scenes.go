@@ -0,0 +1,355 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"raytracer/internal"
+)
+
+// earthTexture is not part of the repository, the earth scene needs a copy of it to render
+const earthTexture = "textures/earthmap.jpg"
+
+type scene struct {
+	name string
+	// assets are files the scene loads that do not come with the repository, relative to the working directory
+	assets []string
+	// build creates the camera and world. Anything random in the scene is drawn from seed, which also seeds
+	// the camera.
+	build func(seed int64, overrides ...internal.CameraOpt) (*internal.Camera, *internal.World, error)
+}
+
+var scenes = []scene{
+	{name: "randSpheres", build: randSpheres},
+	{name: "bouncingSpheres", build: bouncingSpheres},
+	{name: "skySpheres", build: skySpheres},
+	{name: "earth", assets: []string{earthTexture}, build: earth},
+	{name: "perlinDemo", build: perlinDemo},
+	{name: "quadDemo", build: quadDemo},
+	{name: "simpleLightDemo", build: simpleLightDemo},
+	{name: "cornellBox", build: cornellBox},
+	{name: "cornellSmoke", build: cornellSmoke},
+}
+
+func findScene(name string) (scene, bool) {
+	for _, s := range scenes {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return scene{}, false
+}
+
+// missingAssets are the assets of the scene that can not be found
+func (s scene) missingAssets() []string {
+	var missing []string
+	for _, asset := range s.assets {
+		if _, err := os.Stat(asset); errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, asset)
+		}
+	}
+	return missing
+}
+
+// withOverrides appends the command line overrides after a scene's defaults so they take precedence
+func withOverrides(overrides []internal.CameraOpt, defaults ...internal.CameraOpt) []internal.CameraOpt {
+	return append(defaults, overrides...)
+}
+
+func earth(seed int64, overrides ...internal.CameraOpt) (*internal.Camera, *internal.World, error) {
+	camera := internal.NewCamera(
+		16.0/9.0,
+		400.0,
+		withOverrides(overrides,
+			internal.WithSeed(seed),
+			internal.WithSamplesPerPixel(100),
+			internal.WithMaxRayDepth(50),
+			internal.WithLookFrom(internal.NewVec3(0, 0, 12)),
+			internal.WithLookAt(internal.NewVec3(0, 0, 0)),
+			internal.WithFOVDegrees(20),
+			internal.WithDefocusAngleDegrees(0),
+			internal.WithBackgroundColor(internal.NewVec3(0.7, 0.8, 1)),
+		)...,
+	)
+	world := internal.NewWorld()
+
+	earthImg, err := internal.LoadJPEG(earthTexture)
+	if err != nil {
+		return nil, nil, fmt.Errorf("the earth scene needs an equirectangular map of the earth: %w", err)
+	}
+	earthTex := internal.NewImageTexture(earthImg)
+	mat := internal.NewLambertian(&earthTex)
+	world.Add(internal.NewSphere(internal.NewVec3(0, 0, 0), 2, &mat))
+
+	return camera, world, nil
+}
+
+func perlinDemo(seed int64, overrides ...internal.CameraOpt) (*internal.Camera, *internal.World, error) {
+	camera := internal.NewCamera(
+		16.0/9.0,
+		400.0,
+		withOverrides(overrides,
+			internal.WithSeed(seed),
+			internal.WithSamplesPerPixel(100),
+			internal.WithMaxRayDepth(50),
+			internal.WithLookFrom(internal.NewVec3(13, 2, 3)),
+			internal.WithLookAt(internal.NewVec3(0, 0, 0)),
+			internal.WithFOVDegrees(20),
+			internal.WithDefocusAngleDegrees(0),
+			internal.WithBackgroundColor(internal.NewVec3(0.7, 0.8, 1)),
+		)...,
+	)
+	world := internal.NewWorld()
+
+	src := rand.NewSource(seed)
+	randCtx := rand.New(src)
+
+	perlinTex := internal.NewNoiseTexture(randCtx, 4)
+	mat := internal.NewLambertian(&perlinTex)
+	world.Add(internal.NewSphere(internal.NewVec3(0, -1000, 0), 1000, &mat))
+	world.Add(internal.NewSphere(internal.NewVec3(0, 2, 0), 2, &mat))
+
+	return camera, world, nil
+}
+
+func quadDemo(seed int64, overrides ...internal.CameraOpt) (*internal.Camera, *internal.World, error) {
+	camera := internal.NewCamera(
+		16.0/9.0,
+		400.0,
+		withOverrides(overrides,
+			internal.WithSeed(seed),
+			internal.WithSamplesPerPixel(100),
+			internal.WithMaxRayDepth(50),
+			internal.WithLookFrom(internal.NewVec3(0, 0, 9)),
+			internal.WithLookAt(internal.NewVec3(0, 0, 0)),
+			internal.WithFOVDegrees(80),
+			internal.WithDefocusAngleDegrees(0),
+			internal.WithBackgroundColor(internal.NewVec3(0.7, 0.8, 1)),
+		)...,
+	)
+	world := internal.NewWorld()
+
+	leftRed := internal.NewLambertian(internal.NewSolidColor(1, 0.2, 0.2))
+	backGreen := internal.NewLambertian(internal.NewSolidColor(0.2, 1, 0.2))
+	rightBlue := internal.NewLambertian(internal.NewSolidColor(0.2, 0.2, 1))
+	upperOrange := internal.NewLambertian(internal.NewSolidColor(1, 0.5, 0))
+	lowerTeal := internal.NewLambertian(internal.NewSolidColor(0.2, 0.8, 0.8))
+
+	world.Add(internal.NewQuad(internal.NewVec3(-3, -2, 5), internal.NewVec3(0, 0, -4), internal.NewVec3(0, 4, 0), &leftRed))
+	world.Add(internal.NewQuad(internal.NewVec3(-2, -2, 0), internal.NewVec3(4, 0, 0), internal.NewVec3(0, 4, 0), &backGreen))
+	world.Add(internal.NewQuad(internal.NewVec3(3, -2, 1), internal.NewVec3(0, 0, 4), internal.NewVec3(0, 4, 0), &rightBlue))
+	world.Add(internal.NewQuad(internal.NewVec3(-2, 3, 1), internal.NewVec3(4, 0, 0), internal.NewVec3(0, 0, 4), &upperOrange))
+	world.Add(internal.NewQuad(internal.NewVec3(-2, -3, 5), internal.NewVec3(4, 0, 0), internal.NewVec3(0, 0, -4), &lowerTeal))
+
+	return camera, world, nil
+}
+
+func simpleLightDemo(seed int64, overrides ...internal.CameraOpt) (*internal.Camera, *internal.World, error) {
+	camera := internal.NewCamera(
+		16.0/9.0,
+		400.0,
+		withOverrides(overrides,
+			internal.WithSeed(seed),
+			internal.WithSamplesPerPixel(500),
+			internal.WithMaxRayDepth(50),
+			internal.WithLookFrom(internal.NewVec3(26, 3, 6)),
+			internal.WithLookAt(internal.NewVec3(0, 2, 0)),
+			internal.WithFOVDegrees(20),
+			internal.WithDefocusAngleDegrees(0),
+			internal.WithBackgroundColor(internal.NewVec3Zero()),
+			internal.WithToneMapper(internal.ToneMapReinhard),
+		)...,
+	)
+	world := internal.NewWorld()
+
+	src := rand.NewSource(seed)
+	randCtx := rand.New(src)
+
+	perlinTex := internal.NewNoiseTexture(randCtx, 4)
+	mat := internal.NewLambertian(&perlinTex)
+	world.Add(internal.NewSphere(internal.NewVec3(0, -1000, 0), 1000, &mat))
+	world.Add(internal.NewSphere(internal.NewVec3(0, 2, 0), 2, &mat))
+
+	red := internal.NewLambertian(internal.NewSolidColor(1, 0, 0))
+	world.Add(internal.NewSphere(internal.NewVec3(-4, 2, 4), 2, &red))
+
+	diffLight := internal.NewDiffuseLight(internal.NewSolidColor(4, 4, 4))
+	world.Add(internal.NewSphere(internal.NewVec3(0, 7, 0), 2, &diffLight))
+
+	return camera, world, nil
+}
+
+func cornellBox(seed int64, overrides ...internal.CameraOpt) (*internal.Camera, *internal.World, error) {
+	camera := internal.NewCamera(
+		1,
+		600.0,
+		withOverrides(overrides,
+			internal.WithSeed(seed),
+			internal.WithSamplesPerPixel(200),
+			internal.WithMaxRayDepth(50),
+			internal.WithLookFrom(internal.NewVec3(278, 278, -800)),
+			internal.WithLookAt(internal.NewVec3(278, 278, 0)),
+			internal.WithFOVDegrees(40),
+			internal.WithDefocusAngleDegrees(0),
+			internal.WithBackgroundColor(internal.NewVec3Zero()),
+		)...,
+	)
+	world := internal.NewWorld()
+
+	red := internal.NewLambertian(internal.NewSolidColor(.65, .05, .05))
+	white := internal.NewLambertian(internal.NewSolidColor(.73, .73, .73))
+	green := internal.NewLambertian(internal.NewSolidColor(.12, .45, .15))
+	light := internal.NewDiffuseLight(internal.NewSolidColor(15, 15, 15))
+
+	world.Add(internal.NewQuad(internal.NewVec3(555, 0, 0), internal.NewVec3(0, 555, 0), internal.NewVec3(0, 0, 555), &green))
+	world.Add(internal.NewQuad(internal.NewVec3(0, 0, 0), internal.NewVec3(0, 555, 0), internal.NewVec3(0, 0, 555), &red))
+	world.Add(internal.NewQuad(internal.NewVec3(343, 554, 332), internal.NewVec3(-130, 0, 0), internal.NewVec3(0, 0, -105), &light))
+	world.Add(internal.NewQuad(internal.NewVec3(0, 0, 0), internal.NewVec3(555, 0, 0), internal.NewVec3(0, 0, 555), &white))
+	world.Add(internal.NewQuad(internal.NewVec3(555, 555, 555), internal.NewVec3(-555, 0, 0), internal.NewVec3(0, 0, -555), &white))
+	world.Add(internal.NewQuad(internal.NewVec3(0, 0, 555), internal.NewVec3(555, 0, 0), internal.NewVec3(0, 555, 0), &white))
+
+	tallBox := internal.NewWorld()
+	tallBox.Add(internal.Box(internal.NewVec3(0, 0, 0), internal.NewVec3(165, 330, 165), &white)...)
+	world.Add(internal.NewTranslate(internal.NewRotateY(tallBox, 15), internal.NewVec3(265, 0, 295)))
+
+	shortBox := internal.NewWorld()
+	shortBox.Add(internal.Box(internal.NewVec3(0, 0, 0), internal.NewVec3(165, 165, 165), &white)...)
+	world.Add(internal.NewTranslate(internal.NewRotateY(shortBox, -18), internal.NewVec3(130, 0, 65)))
+
+	return camera, world, nil
+}
+
+func randSpheres(seed int64, overrides ...internal.CameraOpt) (*internal.Camera, *internal.World, error) {
+	return randomSpheres(seed, false, overrides...)
+}
+
+// bouncingSpheres is randSpheres with the small diffuse spheres bouncing up while the shutter is open
+func bouncingSpheres(seed int64, overrides ...internal.CameraOpt) (*internal.Camera, *internal.World, error) {
+	return randomSpheres(seed, true, append([]internal.CameraOpt{internal.WithShutter(0, 1)}, overrides...)...)
+}
+
+// skySpheres is randSpheres outdoors in the late afternoon sun
+func skySpheres(seed int64, overrides ...internal.CameraOpt) (*internal.Camera, *internal.World, error) {
+	sky := internal.NewSky(
+		internal.WithSunElevation(25),
+		internal.WithSunAzimuth(-60),
+		internal.WithTurbidity(3),
+	)
+	return randomSpheres(seed, false, append([]internal.CameraOpt{internal.WithEnvironment(sky)}, overrides...)...)
+}
+
+func randomSpheres(seed int64, bouncing bool, overrides ...internal.CameraOpt) (*internal.Camera, *internal.World, error) {
+	camera := internal.NewCamera(
+		16.0/9.0,
+		400.0,
+		withOverrides(overrides,
+			internal.WithSeed(seed),
+			internal.WithSamplesPerPixel(500),
+			internal.WithMaxRayDepth(50),
+			internal.WithLookFrom(internal.NewVec3(13, 2, 3)),
+			internal.WithLookAt(internal.NewVec3(0, 0, 0)),
+			internal.WithFOVDegrees(20),
+			internal.WithDefocusAngleDegrees(0.6),
+			internal.WithFocusDist(10),
+			internal.WithBackgroundColor(internal.NewVec3(0.7, 0.8, 1)),
+		)...,
+	)
+	world := internal.NewWorld()
+
+	checkered := internal.NewCheckered(0.32, internal.NewVec3(0.2, 0.3, 0.1), internal.NewVec3(0.9, 0.9, 0.9))
+	matGround := internal.NewLambertian(&checkered)
+	world.Add(internal.NewSphere(internal.NewVec3(0, -1000, 0), 1000, &matGround))
+
+	src := rand.NewSource(seed)
+	randCtx := rand.New(src)
+	p := internal.NewVec3(4, 0.2, 0)
+	for i := -11; i < 11; i++ {
+		for j := -11; j < 11; j++ {
+			matPer := randCtx.Float32()
+			center := internal.NewVec3(float32(i)+0.9*randCtx.Float32(), 0.2, float32(j)+0.9*randCtx.Float32())
+
+			dist := internal.Sub(center, p)
+			ln := dist.Len()
+			if ln > 0.9 {
+				var sphereMat internal.Material
+				if matPer < 0.8 {
+					randCol := internal.Mul(internal.NewVec3Rand32(randCtx), internal.NewVec3Rand32(randCtx))
+					tex := internal.NewSolidColor(randCol.X, randCol.Y, randCol.Z)
+					mat := internal.NewLambertian(tex)
+					if bouncing {
+						center1 := internal.Add(center, internal.NewVec3(0, internal.RandF32N(randCtx, 0, 0.5), 0))
+						world.Add(internal.NewMovingSphere(center, center1, 0, 1, 0.2, &mat))
+						continue
+					}
+					sphereMat = &mat
+				} else if matPer < 0.95 {
+					albedo := internal.NewVec3RandRange32(randCtx, 0.5, 1)
+					fuzz := internal.RandF32N(randCtx, 0, 0.5)
+					mat := internal.NewMetal(albedo, fuzz)
+					sphereMat = &mat
+				} else {
+					mat := internal.NewDielectric(1.5)
+					sphereMat = &mat
+				}
+				world.Add(internal.NewSphere(center, 0.2, sphereMat))
+			}
+
+		}
+	}
+
+	m1 := internal.NewDielectric(1.5)
+	world.Add(internal.NewSphere(internal.NewVec3(0, 1, 0), 1, &m1))
+
+	m2 := internal.NewLambertian(internal.NewSolidColor(0.4, 0.2, 0.1))
+	world.Add(internal.NewSphere(internal.NewVec3(-4, 1, 0), 1, &m2))
+
+	m3 := internal.NewMetal(internal.NewVec3(0.7, 0.6, 0.5), 0)
+	world.Add(internal.NewSphere(internal.NewVec3(4, 1, 0), 1, &m3))
+
+	return camera, world, nil
+}
+
+// cornellSmoke is the Cornell box with its boxes replaced by black and white smoke
+func cornellSmoke(seed int64, overrides ...internal.CameraOpt) (*internal.Camera, *internal.World, error) {
+	camera := internal.NewCamera(
+		1,
+		600.0,
+		withOverrides(overrides,
+			internal.WithSeed(seed),
+			internal.WithSamplesPerPixel(200),
+			internal.WithMaxRayDepth(50),
+			internal.WithLookFrom(internal.NewVec3(278, 278, -800)),
+			internal.WithLookAt(internal.NewVec3(278, 278, 0)),
+			internal.WithFOVDegrees(40),
+			internal.WithDefocusAngleDegrees(0),
+			internal.WithBackgroundColor(internal.NewVec3Zero()),
+		)...,
+	)
+	world := internal.NewWorld()
+
+	red := internal.NewLambertian(internal.NewSolidColor(.65, .05, .05))
+	white := internal.NewLambertian(internal.NewSolidColor(.73, .73, .73))
+	green := internal.NewLambertian(internal.NewSolidColor(.12, .45, .15))
+	light := internal.NewDiffuseLight(internal.NewSolidColor(7, 7, 7))
+	blackSmoke := internal.NewIsotropic(internal.NewSolidColor(0, 0, 0))
+	whiteSmoke := internal.NewIsotropic(internal.NewSolidColor(1, 1, 1))
+
+	world.Add(internal.NewQuad(internal.NewVec3(555, 0, 0), internal.NewVec3(0, 555, 0), internal.NewVec3(0, 0, 555), &green))
+	world.Add(internal.NewQuad(internal.NewVec3(0, 0, 0), internal.NewVec3(0, 555, 0), internal.NewVec3(0, 0, 555), &red))
+	world.Add(internal.NewQuad(internal.NewVec3(113, 554, 127), internal.NewVec3(330, 0, 0), internal.NewVec3(0, 0, 305), &light))
+	world.Add(internal.NewQuad(internal.NewVec3(0, 0, 0), internal.NewVec3(555, 0, 0), internal.NewVec3(0, 0, 555), &white))
+	world.Add(internal.NewQuad(internal.NewVec3(0, 555, 0), internal.NewVec3(555, 0, 0), internal.NewVec3(0, 0, 555), &white))
+	world.Add(internal.NewQuad(internal.NewVec3(0, 0, 555), internal.NewVec3(555, 0, 0), internal.NewVec3(0, 555, 0), &white))
+
+	tallBox := internal.NewWorld()
+	tallBox.Add(internal.Box(internal.NewVec3(0, 0, 0), internal.NewVec3(165, 330, 165), &white)...)
+	world.Add(internal.NewConstantMedium(internal.NewTranslate(internal.NewRotateY(tallBox, 15), internal.NewVec3(265, 0, 295)), 0.01, &blackSmoke))
+
+	shortBox := internal.NewWorld()
+	shortBox.Add(internal.Box(internal.NewVec3(0, 0, 0), internal.NewVec3(165, 165, 165), &white)...)
+	world.Add(internal.NewConstantMedium(internal.NewTranslate(internal.NewRotateY(shortBox, -18), internal.NewVec3(130, 0, 65)), 0.01, &whiteSmoke))
+
+	return camera, world, nil
+}